@@ -0,0 +1,70 @@
+package ssdp
+
+import (
+	"net"
+)
+
+// AdmissionPolicy decides whether Advertiser responds to a M-SEARCH or not.
+type AdmissionPolicy interface {
+	// Admit returns true to respond to req from src.
+	Admit(src Source, req *MSearch) bool
+}
+
+// AdmissionPolicyFunc type is an adapter to allow the use of ordinary
+// functions as admission policies.
+type AdmissionPolicyFunc func(src Source, req *MSearch) bool
+
+func (f AdmissionPolicyFunc) Admit(src Source, req *MSearch) bool {
+	return f(src, req)
+}
+
+// localSourcePolicy admits M-SEARCH from private, loopback and link-local
+// addresses, or addresses in networks of the receiving interface.
+type localSourcePolicy struct {
+	addrsOf func(*net.Interface) ([]net.Addr, error)
+}
+
+func (p localSourcePolicy) Admit(src Source, _ *MSearch) bool {
+	a, ok := src.From.(*net.UDPAddr)
+	if !ok {
+		return false
+	}
+	if a.IP.IsPrivate() || a.IP.IsLoopback() || a.IP.IsLinkLocalUnicast() {
+		return true
+	}
+	if src.Interface == nil {
+		return false
+	}
+	addrs, err := p.addrsOf(src.Interface)
+	if err != nil {
+		return false
+	}
+	for _, addr := range addrs {
+		if ipnet, ok := addr.(*net.IPNet); ok && ipnet.Contains(a.IP) {
+			return true
+		}
+	}
+	return false
+}
+
+// AdvertiserStats is statistics of responses by Advertiser.
+type AdvertiserStats struct {
+	// Responded is a number of responses which were sent or scheduled.
+	Responded uint64
+
+	// Suppressed is a number of responses which were suppressed by rate
+	// limits.
+	Suppressed uint64
+
+	// Rejected is a number of M-SEARCH which were rejected by
+	// LocalSourcesOnly() or UseAdmissionPolicy().
+	Rejected uint64
+
+	// Filtered is a number of packets which were ignored by AllowSources(),
+	// DenySources() or SourceInterfaces().
+	Filtered uint64
+
+	// Dropped is a number of responses which were dropped because too many
+	// responses were waiting to be sent.  See MaxPendingResponses().
+	Dropped uint64
+}
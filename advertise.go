@@ -1,14 +1,16 @@
 package ssdp
 
 import (
-	"bufio"
 	"bytes"
 	"errors"
 	"fmt"
 	"io"
+	"math/rand/v2"
 	"net"
-	"net/http"
+	"strconv"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/koron/go-ssdp/internal/multicast"
 	"github.com/koron/go-ssdp/internal/ssdplog"
@@ -21,15 +23,55 @@ type message struct {
 
 // Advertiser is a server to advertise a service.
 type Advertiser struct {
-	st      string
-	usn     string
-	locProv LocationProvider
-	server  string
-	maxAge  int
+	// targets is guarded by tmu, because Server modifies it.
+	targets []target
+	tmu     sync.RWMutex
+
+	// uda holds values of UPnP Device Architecture 1.1 headers.
+	// It is guarded by umu, because Update() modifies it.
+	uda         udaHeader
+	umu         sync.Mutex
+	bootIDStore BootIDStore
 
 	mu   sync.Mutex
-	conn *multicast.Conn
+	conn TransportConn
 	wg   sync.WaitGroup
+	done chan struct{}
+
+	// uconn receives unicast M-SEARCH on the port of SearchPort().  It is
+	// nil when the option is not given.
+	uconn TransportConn
+
+	// schedule is a configuration for AutoAlive(), and swg waits for the
+	// scheduler and the interface watcher.
+	schedule scheduleConfig
+	swg      sync.WaitGroup
+
+	// announced indicates alive is announced and bye is not yet.  Alive is
+	// sent on interfaces which appeared, while this is true.
+	announced atomic.Bool
+
+	log  *ssdplog.Logger
+	errs errorReporter
+
+	// stopped is closed when receiving packets stopped, and err is an error
+	// which stopped it.
+	stopped chan struct{}
+	err     error
+
+	// limiter limits responses, it is nil when no limits.  policies decide
+	// to respond to M-SEARCH or not.
+	limiter  *rateLimiter
+	policies []AdmissionPolicy
+	filter   *sourceFilter
+
+	// responder sends responses after delays, which are specified by MX.
+	responder *responder
+
+	responded  atomic.Uint64
+	suppressed atomic.Uint64
+	rejected   atomic.Uint64
+	filtered   atomic.Uint64
 
 	// addHost is an optional flag to add HOST header for M-SEARCH response.
 	// It is to support SmartThings.
@@ -37,107 +79,360 @@ type Advertiser struct {
 	addHost bool
 }
 
+// target is a pair of NT (ST for responses) and USN to advertise, with
+// properties for them.
+type target struct {
+	nt      string
+	usn     string
+	locProv LocationProvider
+	server  string
+	maxAge  int
+}
+
+// newTargets creates targets from pairs of NT and USN, with common
+// properties.
+func newTargets(pairs [][2]string, location any, server string, maxAge int) ([]target, error) {
+	locProv, err := toLocationProvider(location)
+	if err != nil {
+		return nil, err
+	}
+	targets := make([]target, 0, len(pairs))
+	for _, p := range pairs {
+		targets = append(targets, target{
+			nt:      p[0],
+			usn:     p[1],
+			locProv: locProv,
+			server:  server,
+			maxAge:  maxAge,
+		})
+	}
+	return targets, nil
+}
+
 // Advertise starts advertisement of service.
 // location should be a string or a ssdp.LocationProvider.
 func Advertise(st, usn string, location any, server string, maxAge int, opts ...Option) (*Advertiser, error) {
-	locProv, err := toLocationProvider(location)
+	targets, err := newTargets([][2]string{{st, usn}}, location, server, maxAge)
 	if err != nil {
 		return nil, err
 	}
+	return advertise(targets, opts)
+}
+
+func advertise(targets []target, opts []Option) (*Advertiser, error) {
 	cfg, err := opts2config(opts)
 	if err != nil {
 		return nil, err
 	}
-	conn, err := multicast.Listen(multicast.RecvAddrResolver, cfg.multicastConfig.options()...)
+	uda, err := cfg.udaConfig.header(true)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := cfg.multicastConfig.transport().ListenMulticast()
 	if err != nil {
 		return nil, err
 	}
-	ssdplog.Printf("SSDP advertise on: %s", conn.LocalAddr().String())
+	cfg.log.Info("SSDP advertise", ssdplog.KeyEvent, "advertise", "local", conn.LocalAddr().String())
+	// a device which sends SEARCHPORT.UPNP.ORG should respond to unicast
+	// M-SEARCH on the port.
+	var uconn TransportConn
+	if cfg.searchPort > 0 {
+		uconn, err = cfg.multicastConfig.transport().ListenUnicast(":" + strconv.Itoa(cfg.searchPort))
+		if err != nil {
+			conn.Close()
+			return nil, err
+		}
+		cfg.log.Info("SSDP advertise", ssdplog.KeyEvent, "advertise", "local", uconn.LocalAddr().String())
+	}
 	a := &Advertiser{
-		st:      st,
-		usn:     usn,
-		locProv: locProv,
-		server:  server,
-		maxAge:  maxAge,
+		log:     cfg.log,
+		errs:    errorReporter{h: cfg.errorHandler, log: cfg.log},
+		targets: targets,
+		uda:     uda,
 		conn:    conn,
+		uconn:   uconn,
+		done:    make(chan struct{}),
+		stopped: make(chan struct{}),
 		addHost: cfg.advertiseConfig.addHost,
+
+		bootIDStore: cfg.udaConfig.bootIDStore,
+		schedule:    cfg.scheduleConfig,
+		limiter:     newRateLimiter(cfg.perSourceLimit, cfg.globalLimit),
+		filter:      newSourceFilter(cfg.filterConfig),
+	}
+	if cfg.localOnly {
+		a.policies = append(a.policies, localSourcePolicy{addrsOf: interfaceAddrsOf(conn)})
+	}
+	if cfg.admission != nil {
+		a.policies = append(a.policies, cfg.admission)
 	}
-	a.wg.Add(1)
+	a.responder = newResponder(cfg.maxPending, a.done, a.sendLater)
+	a.wg.Add(2)
 	go func() {
-		a.recvMain()
-		a.wg.Done()
+		defer a.wg.Done()
+		a.responder.run()
 	}()
+	go func() {
+		defer a.wg.Done()
+		if err := a.recvMain(conn); err != nil {
+			a.err = err
+			a.errs.report("advertise", err)
+		}
+		close(a.stopped)
+	}()
+	if uconn != nil {
+		a.wg.Add(1)
+		go func() {
+			defer a.wg.Done()
+			if err := a.recvMain(uconn); err != nil {
+				a.errs.report("advertise", err)
+			}
+		}()
+	}
+	if a.schedule.autoAlive {
+		a.announced.Store(true)
+		a.swg.Add(1)
+		go func() {
+			a.aliveMain()
+			a.swg.Done()
+		}()
+	}
+	if d := cfg.multicastConfig.interfaceWatchInterval(); d > 0 {
+		a.swg.Add(1)
+		go func() {
+			watchInterfaces(conn, d, a.done, a.log, a.aliveJoined)
+			a.swg.Done()
+		}()
+	}
 	return a, nil
 }
 
-func (a *Advertiser) recvMain() error {
-	// TODO: update listening interfaces of a.conn
-	err := a.conn.ReadPackets(0, func(addr net.Addr, data []byte) error {
-		if err := a.handleRaw(addr, data); err != nil {
-			ssdplog.Printf("failed to handle message: %s", err)
+// recvMain receives M-SEARCH from conn, and responds through it.
+func (a *Advertiser) recvMain(conn TransportConn) error {
+	err := conn.ReadPackets(0, func(addr net.Addr, data []byte, ifi *net.Interface, dst net.Addr) error {
+		src := newSource(addr, ifi, dst)
+		if !a.filter.accept(src) {
+			a.filtered.Add(1)
+			a.log.Debug("filtered packet", ssdplog.KeyEvent, "search", ssdplog.KeyFrom, addr.String(), ssdplog.KeyInterface, interfaceName(ifi))
+			return nil
+		}
+		if err := a.handleRaw(conn, src, data); err != nil {
+			a.errs.report("search", err)
 		}
 		return nil
 	})
 	if err != nil && err != io.EOF {
-		return err
+		return &ReadError{Err: err}
 	}
 	return nil
 }
 
-func (a *Advertiser) handleRaw(from net.Addr, raw []byte) error {
+func (a *Advertiser) handleRaw(conn TransportConn, src Source, raw []byte) error {
 	if !bytes.HasPrefix(raw, []byte("M-SEARCH ")) {
 		// unexpected method.
 		return nil
 	}
-	req, err := http.ReadRequest(bufio.NewReader(bytes.NewReader(raw)))
+	msg, err := ParseMessage(raw)
 	if err != nil {
-		return err
+		return &ParseError{From: src.From, Raw: bytes.Clone(raw), Err: err}
 	}
-	var (
-		man = req.Header.Get("MAN")
-		st  = req.Header.Get("ST")
-	)
-	if man != `"ssdp:discover"` {
-		return fmt.Errorf("unexpected MAN: %s", man)
+	req, ok := msg.(*MSearch)
+	if !ok {
+		return nil
+	}
+	st := req.ST
+	if req.MAN != manDiscover {
+		return &UnexpectedMANError{From: src.From, MAN: req.MAN}
+	}
+	// multicast M-SEARCH should be responded after random delay which
+	// specified by MX, unicast one should be responded immediately.  MX is
+	// validated before admission and rate limits, not to consume tokens by
+	// invalid requests.
+	var delay time.Duration
+	if !isUnicastSearch(req.Host) {
+		mx, err := limitMX(req.MX)
+		if err != nil {
+			return err
+		}
+		delay = responseDelay(mx)
 	}
-	if st != All && st != RootDevice && st != a.st {
+	targets := a.match(st)
+	if len(targets) == 0 {
 		// skip when ST is not matched/expected.
 		return nil
 	}
-	ssdplog.Printf("received M-SEARCH MAN=%s ST=%s from %s", man, st, from.String())
+	if src.Interface == nil {
+		src.Interface = zoneInterface(src.From)
+	}
+	if !a.admit(src, req) {
+		a.rejected.Add(1)
+		a.log.Debug("rejected M-SEARCH", ssdplog.KeyEvent, "search", ssdplog.KeyST, st, ssdplog.KeyFrom, src.From.String())
+		return nil
+	}
+	// suppress responses over rate limits.
+	if n := a.limiter.allow(src.From, len(targets)); n < len(targets) {
+		a.suppressed.Add(uint64(len(targets) - n))
+		a.log.Debug("suppressed responses", ssdplog.KeyEvent, "search", ssdplog.KeyST, st, ssdplog.KeyFrom, src.From.String(), "suppressed", len(targets)-n)
+		if n == 0 {
+			return nil
+		}
+		targets = targets[:n]
+	}
+	from := src.From
+	a.log.Debug("received M-SEARCH", ssdplog.KeyEvent, "search", ssdplog.KeyST, st, ssdplog.KeyFrom, from.String(), ssdplog.KeyInterface, interfaceName(src.Interface))
 	// build and send a response.
 	var host string
 	if a.addHost {
-		addr, err := multicast.SendAddr()
-		if err != nil {
+		if addr := groupFor(a.conn, from); addr != nil {
+			host = addr.String()
+		}
+	}
+	// respond with locations for the interface which received M-SEARCH,
+	// and through it.
+	addrsOf := interfaceAddrsOf(a.conn)
+	src.LocalAddr = localAddr(src, addrsOf)
+	var (
+		uda  = a.udaHeader()
+		msgs = make([][]byte, 0, len(targets))
+	)
+	for _, t := range targets {
+		// ST of responses is NT of each target, it is same with the request
+		// except ssdp:all and the fallback of upnp:rootdevice.
+		msgs = append(msgs, buildOK(t.nt, t.usn, searchLocation(t.locProv, addrsOf, src), t.server, t.maxAge, host, uda))
+	}
+	if delay <= 0 {
+		a.responded.Add(uint64(len(msgs)))
+		return writeAll(conn, msgs, from, src.Interface)
+	}
+	if !a.responder.schedule(&response{at: time.Now().Add(delay), conn: conn, to: from, ifi: src.Interface, msgs: msgs}) {
+		a.log.Warn("dropped responses", ssdplog.KeyEvent, "search", ssdplog.KeyST, st, ssdplog.KeyFrom, from.String(), "dropped", len(msgs))
+		return nil
+	}
+	a.responded.Add(uint64(len(msgs)))
+	return nil
+}
+
+// admit checks all admission policies admit a M-SEARCH.
+func (a *Advertiser) admit(src Source, req *MSearch) bool {
+	for _, p := range a.policies {
+		if !p.Admit(src, req) {
+			return false
+		}
+	}
+	return true
+}
+
+// Stats returns statistics of responses.
+func (a *Advertiser) Stats() AdvertiserStats {
+	return AdvertiserStats{
+		Responded:  a.responded.Load(),
+		Suppressed: a.suppressed.Load(),
+		Rejected:   a.rejected.Load(),
+		Filtered:   a.filtered.Load(),
+		Dropped:    a.responder.dropped.Load(),
+	}
+}
+
+// match returns targets which match with ST of M-SEARCH.
+func (a *Advertiser) match(st string) []target {
+	targets := a.currentTargets()
+	if st == All {
+		return targets
+	}
+	var matched []target
+	for _, t := range targets {
+		if t.nt == st {
+			matched = append(matched, t)
+		}
+	}
+	// Advertisers without "upnp:rootdevice" respond to it with the first
+	// target only, for compatibility.  The response has NT of the target as
+	// ST, to keep a pair of ST and USN.
+	if len(matched) == 0 && st == RootDevice && len(targets) > 0 {
+		return targets[:1]
+	}
+	return matched
+}
+
+// currentTargets returns a snapshot of targets.
+func (a *Advertiser) currentTargets() []target {
+	a.tmu.RLock()
+	defer a.tmu.RUnlock()
+	return a.targets
+}
+
+// sendLater is called by responder to send delayed responses.  Pending
+// responses are canceled by Close().
+func (a *Advertiser) sendLater(r *response) {
+	if err := writeAll(r.conn, r.msgs, r.to, r.ifi); err != nil {
+		a.log.Error("failed to send a response", ssdplog.KeyEvent, "response", ssdplog.KeyFrom, r.to.String(), ssdplog.KeyError, err)
+		a.errs.notify(err)
+	}
+}
+
+// writeAll sends messages to an address through an interface.  The
+// interface is chosen by the system when ifi is nil.
+func writeAll(conn TransportConn, msgs [][]byte, to net.Addr, ifi *net.Interface) error {
+	for _, msg := range msgs {
+		if _, err := conn.WriteTo(bytesData(msg), to, ifi); err != nil {
 			return err
 		}
-		host = addr.String()
 	}
-	msg := buildOK(a.st, a.usn, a.locProv.Location(from, nil), a.server, a.maxAge, host)
-	_, err = a.conn.WriteTo(multicast.BytesDataProvider(msg), from)
-	return err
+	return nil
 }
 
-func buildOK(st, usn, location, server string, maxAge int, host string) []byte {
-	// bytes.Buffer#Write() is never fail, so we can omit error checks.
-	b := new(bytes.Buffer)
-	b.WriteString("HTTP/1.1 200 OK\r\n")
-	fmt.Fprintf(b, "EXT: \r\n")
-	fmt.Fprintf(b, "ST: %s\r\n", st)
-	fmt.Fprintf(b, "USN: %s\r\n", usn)
-	if location != "" {
-		fmt.Fprintf(b, "LOCATION: %s\r\n", location)
+// maxMX is the maximum value of MX, defined by UPnP Device Architecture 1.1.
+// Greater values are treated as this.
+const maxMX = 5
+
+// limitMX validates a value of MX header, and limits it to maxMX.
+func limitMX(mx int) (int, error) {
+	if mx < 0 {
+		return 0, errors.New("invalid MX")
 	}
-	if server != "" {
-		fmt.Fprintf(b, "SERVER: %s\r\n", server)
+	if mx < 1 {
+		return 0, fmt.Errorf("MX out of range: %d", mx)
 	}
-	fmt.Fprintf(b, "CACHE-CONTROL: max-age=%d\r\n", maxAge)
-	if host != "" {
-		fmt.Fprintf(b, "HOST: %s\r\n", host)
+	if mx > maxMX {
+		mx = maxMX
 	}
-	b.WriteString("\r\n")
-	return b.Bytes()
+	return mx, nil
+}
+
+// responseMargin is a time reserved from MX for network latency, to deliver
+// a response before the requester stops to wait.
+const responseMargin = 100 * time.Millisecond
+
+// responseDelay returns a random delay between 0 and mx seconds.
+func responseDelay(mx int) time.Duration {
+	d := time.Duration(mx)*time.Second - responseMargin
+	if d <= 0 {
+		return 0
+	}
+	return rand.N(d)
+}
+
+// isUnicastSearch checks a M-SEARCH is unicast or not by its HOST header.
+func isUnicastSearch(host string) bool {
+	h, _, err := net.SplitHostPort(host)
+	if err != nil {
+		h = host
+	}
+	ip := net.ParseIP(h)
+	return ip != nil && !ip.IsMulticast()
+}
+
+func buildOK(st, usn, location, server string, maxAge int, host string, uda udaHeader) []byte {
+	m := &SearchResponse{
+		ST:           st,
+		USN:          usn,
+		Location:     location,
+		Server:       server,
+		CacheControl: fmt.Sprintf("max-age=%d", maxAge),
+		Host:         host,
+		Fields:       uda.fields(),
+	}
+	return m.Marshal()
 }
 
 var ErrAdvertiserClosedAlready = errors.New("advertiser closed already")
@@ -152,49 +447,177 @@ func (a *Advertiser) connGuard(fn func() error) error {
 }
 
 // Close stops advertisement.
+// It sends byebye messages before stopping when AutoAlive() is enabled and
+// alive is announced, in other words Bye() is not called after it.
 func (a *Advertiser) Close() error {
 	return a.connGuard(func() error {
-		a.conn.Close() // 1. Interrupt ReadPackets in recvMain
-		a.wg.Wait()    // 2. Wait for termination of recvMain
+		close(a.done) // 1. Cancel delayed responses and the scheduler
+		a.swg.Wait()
+		if a.schedule.autoAlive && a.announced.Load() {
+			a.burstBye()
+		}
+		a.conn.Close() // 2. Interrupt ReadPackets in recvMain
+		if a.uconn != nil {
+			a.uconn.Close()
+		}
+		a.wg.Wait() // 3. Wait for termination of recvMain and responses
 		a.conn = nil
 		return nil
 	})
 }
 
+// Done returns a channel which is closed when the advertiser stops receiving
+// packets, by Close() or a fatal error.
+func (a *Advertiser) Done() <-chan struct{} {
+	return a.stopped
+}
+
+// Err returns an error which stopped the advertiser, it is a *ReadError.
+// This returns nil while the advertiser is running, or when it is stopped by
+// Close().
+func (a *Advertiser) Err() error {
+	select {
+	case <-a.stopped:
+		return a.err
+	default:
+		return nil
+	}
+}
+
 // Alive announces ssdp:alive message.
 func (a *Advertiser) Alive() error {
 	return a.connGuard(func() error {
-		addr, err := multicast.SendAddr()
-		if err != nil {
-			return err
-		}
-		msg := &aliveDataProvider{
-			host:     addr,
-			nt:       a.st,
-			usn:      a.usn,
-			location: a.locProv,
-			server:   a.server,
-			maxAge:   a.maxAge,
-		}
-		_, err = a.conn.WriteTo(msg, addr)
-		ssdplog.Printf("sent alive")
-		return err
+		a.announced.Store(true)
+		return a.sendAlive(a.currentTargets())
 	})
 }
 
+// aliveJoined sends alive on interfaces which joined newly or changed their
+// addresses, when alive is announced.  Locations are built with current
+// addresses.
+func (a *Advertiser) aliveJoined(joined []multicast.Joined) {
+	if !a.announced.Load() {
+		return
+	}
+	uda := a.udaHeader()
+	targets := a.currentTargets()
+	for _, j := range joined {
+		for _, addr := range j.Groups {
+			for _, t := range targets {
+				msg := &aliveDataProvider{
+					host:     addr,
+					nt:       t.nt,
+					usn:      t.usn,
+					location: t.locProv,
+					addrsOf:  interfaceAddrsOf(a.conn),
+					server:   t.server,
+					maxAge:   t.maxAge,
+					uda:      uda,
+				}
+				if _, err := a.conn.WriteTo(msg.Bytes, addr, j.Interface); err != nil {
+					a.log.Error("failed to send alive", ssdplog.KeyEvent, "alive", ssdplog.KeyInterface, j.Interface.Name, ssdplog.KeyError, err)
+					break
+				}
+			}
+		}
+		a.log.Debug("sent alive", ssdplog.KeyEvent, "alive", ssdplog.KeyInterface, j.Interface.Name)
+	}
+}
+
+func (a *Advertiser) sendAlive(targets []target) error {
+	uda := a.udaHeader()
+	for _, addr := range a.conn.Groups() {
+		for _, t := range targets {
+			msg := &aliveDataProvider{
+				host:     addr,
+				nt:       t.nt,
+				usn:      t.usn,
+				location: t.locProv,
+				addrsOf:  interfaceAddrsOf(a.conn),
+				server:   t.server,
+				maxAge:   t.maxAge,
+				uda:      uda,
+			}
+			if _, err := a.conn.WriteTo(msg.Bytes, addr, nil); err != nil {
+				return err
+			}
+		}
+	}
+	a.log.Debug("sent alive", ssdplog.KeyEvent, "alive")
+	return nil
+}
+
 // Bye announces ssdp:byebye message.
 func (a *Advertiser) Bye() error {
 	return a.connGuard(func() error {
-		addr, err := multicast.SendAddr()
-		if err != nil {
-			return err
+		a.announced.Store(false)
+		return a.sendBye(a.currentTargets())
+	})
+}
+
+func (a *Advertiser) sendBye(targets []target) error {
+	uda := a.udaHeader()
+	for _, addr := range a.conn.Groups() {
+		for _, t := range targets {
+			msg, err := buildBye(addr, t.nt, t.usn, uda)
+			if err != nil {
+				return err
+			}
+			if _, err := a.conn.WriteTo(bytesData(msg), addr, nil); err != nil {
+				return err
+			}
 		}
-		msg, err := buildBye(addr, a.st, a.usn)
-		if err != nil {
-			return err
+	}
+	a.log.Debug("sent bye", ssdplog.KeyEvent, "bye")
+	return nil
+}
+
+// ErrNoBootID is returned by Update() when BOOTID is not configured by
+// BootID() or BootIDFrom() options.
+var ErrNoBootID = errors.New("BOOTID is not configured")
+
+// Update announces ssdp:update message, then increments BOOTID.
+// It should be called when a device changes its interfaces or boot ID
+// without leaving the network.  BootID() or BootIDFrom() option is required.
+func (a *Advertiser) Update() error {
+	return a.connGuard(func() error {
+		uda := a.udaHeader()
+		if uda.bootID < 0 {
+			return ErrNoBootID
+		}
+		next := nextBootID(uda.bootID)
+		if a.bootIDStore != nil {
+			if err := a.bootIDStore.StoreBootID(next); err != nil {
+				return err
+			}
 		}
-		_, err = a.conn.WriteTo(multicast.BytesDataProvider(msg), addr)
-		ssdplog.Printf("sent bye")
-		return err
+		targets := a.currentTargets()
+		for _, addr := range a.conn.Groups() {
+			for _, t := range targets {
+				msg := &updateDataProvider{
+					host:       addr,
+					nt:         t.nt,
+					usn:        t.usn,
+					location:   t.locProv,
+					addrsOf:    interfaceAddrsOf(a.conn),
+					uda:        uda,
+					nextBootID: next,
+				}
+				if _, err := a.conn.WriteTo(msg.Bytes, addr, nil); err != nil {
+					return err
+				}
+			}
+		}
+		a.umu.Lock()
+		a.uda.bootID = next
+		a.umu.Unlock()
+		a.log.Debug("sent update", ssdplog.KeyEvent, "update")
+		return nil
 	})
 }
+
+func (a *Advertiser) udaHeader() udaHeader {
+	a.umu.Lock()
+	defer a.umu.Unlock()
+	return a.uda
+}
@@ -147,3 +147,256 @@ func TestAdvertise_Bye(t *testing.T) {
 		}
 	}
 }
+
+func TestAdvertise_AliveIPv6(t *testing.T) {
+	var mu sync.Mutex
+	var mm []*AliveMessage
+	m := newTestMonitor(t, "test:advertise+aliveipv6", func(m *AliveMessage) {
+		mu.Lock()
+		mm = append(mm, m)
+		mu.Unlock()
+	}, nil, nil, IPv6())
+
+	a, err := Advertise("test:advertise+aliveipv6", "usn:advertise+aliveipv6", "http://[fe80::1%25eth0]:8080/desc.xml", "server:advertise+aliveipv6", 600, IPv6())
+	if err != nil {
+		t.Fatalf("failed to Advertise: %s", err)
+	}
+	err = a.Alive()
+	if err != nil {
+		a.Close()
+		t.Fatalf("failed to send alive: %s", err)
+	}
+
+	a.Close()
+	time.Sleep(monitorWait)
+	m.Close()
+
+	mu.Lock()
+	t.Cleanup(mu.Unlock)
+
+	if len(mm) < 1 {
+		t.Fatal("no alives detected")
+	}
+	for i, m := range mm {
+		if ip := m.From.(*net.UDPAddr).IP; ip.To4() != nil {
+			t.Errorf("alive#%d is not from IPv6 address: %s", i, ip)
+		}
+		if m.USN != "usn:advertise+aliveipv6" {
+			t.Errorf("unexpected alive#%d usn: want=%q got=%q", i, "usn:advertise+aliveipv6", m.USN)
+		}
+		if m.Location != "http://[fe80::1]:8080/desc.xml" {
+			t.Errorf("unexpected alive#%d location: want=%q got=%q", i, "http://[fe80::1]:8080/desc.xml", m.Location)
+		}
+	}
+}
+
+func TestParseMX(t *testing.T) {
+	for i, tc := range []struct {
+		in   string
+		want int
+		err  bool
+	}{
+		{"1", 1, false},
+		{"3", 3, false},
+		{" 5 ", 5, false},
+		{"120", 5, false},
+		{"0", 0, true},
+		{"-1", 0, true},
+		{"", 0, true},
+		{"foo", 0, true},
+		{"1.5", 0, true},
+	} {
+		msg, err := ParseMessage([]byte("M-SEARCH * HTTP/1.1\r\nMX: " + tc.in + "\r\n\r\n"))
+		if err != nil {
+			t.Fatalf("#%d failed to parse: %s", i, err)
+		}
+		got, err := limitMX(msg.(*MSearch).MX)
+		if tc.err {
+			if err == nil {
+				t.Errorf("#%d parseMX(%q) should fail but got %d", i, tc.in, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("#%d parseMX(%q) failed: %s", i, tc.in, err)
+			continue
+		}
+		if got != tc.want {
+			t.Errorf("#%d parseMX(%q) mismatch: want=%d got=%d", i, tc.in, tc.want, got)
+		}
+	}
+}
+
+func TestResponseDelay(t *testing.T) {
+	for mx := 1; mx <= maxMX; mx++ {
+		limit := time.Duration(mx) * time.Second
+		for range 100 {
+			if d := responseDelay(mx); d < 0 || d >= limit {
+				t.Fatalf("delay out of range for MX=%d: %s", mx, d)
+			}
+		}
+	}
+}
+
+func TestIsUnicastSearch(t *testing.T) {
+	for i, tc := range []struct {
+		host string
+		want bool
+	}{
+		{"239.255.255.250:1900", false},
+		{"[ff02::c]:1900", false},
+		{"192.168.0.1:1900", true},
+		{"[fe80::1]:1900", true},
+		{"", false},
+	} {
+		if got := isUnicastSearch(tc.host); got != tc.want {
+			t.Errorf("#%d isUnicastSearch(%q) mismatch: want=%t got=%t", i, tc.host, tc.want, got)
+		}
+	}
+}
+
+func TestAdvertise_Update(t *testing.T) {
+	var mu sync.Mutex
+	var mm []*UpdateMessage
+	m := newTestMonitorWithUpdate(t, "test:advertise+update", nil, nil, nil, func(m *UpdateMessage) {
+		mu.Lock()
+		mm = append(mm, m)
+		mu.Unlock()
+	})
+
+	a, err := Advertise("test:advertise+update", "usn:advertise+update", "location:advertise+update", "server:advertise+update", 600, BootID(5), ConfigID(1))
+	if err != nil {
+		t.Fatalf("failed to Advertise: %s", err)
+	}
+	err = a.Update()
+	if err != nil {
+		a.Close()
+		t.Fatalf("failed to send update: %s", err)
+	}
+	if v := a.udaHeader().bootID; v != 6 {
+		t.Errorf("BOOTID not incremented: want=%d got=%d", 6, v)
+	}
+
+	a.Close()
+	time.Sleep(monitorWait)
+	m.Close()
+
+	mu.Lock()
+	t.Cleanup(mu.Unlock)
+
+	if len(mm) < 1 {
+		t.Fatal("no updates detected")
+	}
+	expHdr := map[string]string{
+		"Nts":                 "ssdp:update",
+		"Nt":                  "test:advertise+update",
+		"Usn":                 "usn:advertise+update",
+		"Location":            "location:advertise+update",
+		"Bootid.upnp.org":     "5",
+		"Configid.upnp.org":   "1",
+		"Nextbootid.upnp.org": "6",
+	}
+	for i, m := range mm {
+		if m.USN != "usn:advertise+update" {
+			t.Errorf("unexpected update#%d usn: want=%q got=%q", i, "usn:advertise+update", m.USN)
+		}
+		if m.Location != "location:advertise+update" {
+			t.Errorf("unexpected update#%d location: want=%q got=%q", i, "location:advertise+update", m.Location)
+		}
+		if v := m.BootID(); v != 5 {
+			t.Errorf("unexpected update#%d BOOTID: want=%d got=%d", i, 5, v)
+		}
+		if v := m.NextBootID(); v != 6 {
+			t.Errorf("unexpected update#%d NEXTBOOTID: want=%d got=%d", i, 6, v)
+		}
+
+		h := m.Header()
+		for k := range h {
+			exp, ok := expHdr[k]
+			if !ok {
+				t.Errorf("unexpected header #%d %q=%q", i, k, h.Get(k))
+			} else if act := h.Get(k); act != exp {
+				t.Errorf("header #%d %q value mismatch:\nwant=%q\n got=%q", i, k, exp, act)
+			}
+		}
+	}
+}
+
+func TestAdvertise_UpdateWithoutBootID(t *testing.T) {
+	a, err := Advertise("test:advertise+updatewithoutbootid", "usn:advertise+updatewithoutbootid", "location:advertise+updatewithoutbootid", "server:advertise+updatewithoutbootid", 600)
+	if err != nil {
+		t.Fatalf("failed to Advertise: %s", err)
+	}
+	defer a.Close()
+	if err := a.Update(); err != ErrNoBootID {
+		t.Errorf("unexpected error: want=%v got=%v", ErrNoBootID, err)
+	}
+}
+
+type testLocalLocation struct {
+	mu    sync.Mutex
+	local []net.Addr
+	ifis  []*net.Interface
+}
+
+func (p *testLocalLocation) Location(net.Addr, *net.Interface) string {
+	return "location:advertise+locallocation"
+}
+
+func (p *testLocalLocation) LocalLocation(from, local net.Addr, ifi *net.Interface) string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.local = append(p.local, local)
+	p.ifis = append(p.ifis, ifi)
+	if local == nil {
+		return "location:advertise+locallocation"
+	}
+	return "http://" + local.String() + "/"
+}
+
+func TestAdvertise_LocalLocation(t *testing.T) {
+	p := &testLocalLocation{}
+	a, err := Advertise("test:advertise+locallocation", "usn:advertise+locallocation", p, "server:advertise+locallocation", 600)
+	if err != nil {
+		t.Fatalf("failed to Advertise: %s", err)
+	}
+	t.Cleanup(func() {
+		a.Close()
+	})
+
+	srvs, err := Search("test:advertise+locallocation", 1, "")
+	if err != nil {
+		t.Fatalf("failed to Search: %s", err)
+	}
+	if len(srvs) == 0 {
+		t.Fatal("no services found")
+	}
+
+	p.mu.Lock()
+	t.Cleanup(p.mu.Unlock)
+	if len(p.local) == 0 {
+		t.Fatal("LocalLocation is not called")
+	}
+	for i, local := range p.local {
+		laddr, ok := local.(*net.UDPAddr)
+		if !ok {
+			t.Errorf("unexpected local address#%d: %+v", i, local)
+			continue
+		}
+		if laddr.IP.IsMulticast() {
+			t.Errorf("local address#%d should not be multicast: %s", i, laddr)
+		}
+		if p.ifis[i] == nil {
+			t.Errorf("no interfaces for local address#%d", i)
+		}
+	}
+	locs := map[string]bool{}
+	for _, local := range p.local {
+		locs["http://"+local.String()+"/"] = true
+	}
+	for i, s := range srvs {
+		if !locs[s.Location] {
+			t.Errorf("unexpected location for service#%d: %s", i, s.Location)
+		}
+	}
+}
@@ -1,11 +1,9 @@
 package ssdp
 
 import (
-	"bytes"
 	"fmt"
 	"net"
-
-	"github.com/koron/go-ssdp/internal/multicast"
+	"strconv"
 )
 
 // AnnounceAlive sends ssdp:alive message.
@@ -19,27 +17,31 @@ func AnnounceAlive(nt, usn string, location any, server string, maxAge int, loca
 	if err != nil {
 		return err
 	}
-	// dial multicast UDP packet.
-	conn, err := multicast.Listen(&multicast.AddrResolver{Addr: localAddr}, cfg.multicastConfig.options()...)
+	uda, err := cfg.udaConfig.header(false)
 	if err != nil {
 		return err
 	}
-	defer conn.Close()
-	// build and send message.
-	addr, err := multicast.SendAddr()
+	// dial multicast UDP packet.
+	conn, err := cfg.multicastConfig.transport().ListenUnicast(localAddr)
 	if err != nil {
 		return err
 	}
-	msg := &aliveDataProvider{
-		host:     addr,
-		nt:       nt,
-		usn:      usn,
-		location: locProv,
-		server:   server,
-		maxAge:   maxAge,
-	}
-	if _, err := conn.WriteTo(msg, addr); err != nil {
-		return err
+	defer conn.Close()
+	// build and send message for each multicast groups.
+	for _, addr := range conn.Groups() {
+		msg := &aliveDataProvider{
+			host:     addr,
+			nt:       nt,
+			usn:      usn,
+			location: locProv,
+			addrsOf:  interfaceAddrsOf(conn),
+			server:   server,
+			maxAge:   maxAge,
+			uda:      uda,
+		}
+		if _, err := conn.WriteTo(msg.Bytes, addr, nil); err != nil {
+			return err
+		}
 	}
 	return nil
 }
@@ -49,33 +51,28 @@ type aliveDataProvider struct {
 	nt       string
 	usn      string
 	location LocationProvider
+	addrsOf  func(*net.Interface) ([]net.Addr, error)
 	server   string
 	maxAge   int
+	uda      udaHeader
 }
 
 func (p *aliveDataProvider) Bytes(ifi *net.Interface) []byte {
-	return buildAlive(p.host, p.nt, p.usn, p.location.Location(nil, ifi), p.server, p.maxAge)
+	return buildAlive(p.host, p.nt, p.usn, location(p.location, p.addrsOf, nil, ifi), p.server, p.maxAge, p.uda)
 }
 
-var _ multicast.DataProvider = (*aliveDataProvider)(nil)
-
-func buildAlive(raddr net.Addr, nt, usn, location, server string, maxAge int) []byte {
-	// bytes.Buffer#Write() is never fail, so we can omit error checks.
-	b := new(bytes.Buffer)
-	b.WriteString("NOTIFY * HTTP/1.1\r\n")
-	fmt.Fprintf(b, "HOST: %s\r\n", raddr.String())
-	fmt.Fprintf(b, "NT: %s\r\n", nt)
-	fmt.Fprintf(b, "NTS: %s\r\n", "ssdp:alive")
-	fmt.Fprintf(b, "USN: %s\r\n", usn)
-	if location != "" {
-		fmt.Fprintf(b, "LOCATION: %s\r\n", location)
-	}
-	if server != "" {
-		fmt.Fprintf(b, "SERVER: %s\r\n", server)
-	}
-	fmt.Fprintf(b, "CACHE-CONTROL: max-age=%d\r\n", maxAge)
-	b.WriteString("\r\n")
-	return b.Bytes()
+func buildAlive(raddr net.Addr, nt, usn, location, server string, maxAge int, uda udaHeader) []byte {
+	m := &Notify{
+		Host:         raddr.String(),
+		NT:           nt,
+		NTS:          NTSAlive,
+		USN:          usn,
+		Location:     location,
+		Server:       server,
+		CacheControl: fmt.Sprintf("max-age=%d", maxAge),
+		Fields:       uda.fields(),
+	}
+	return m.Marshal()
 }
 
 // AnnounceBye sends ssdp:byebye message.
@@ -84,35 +81,107 @@ func AnnounceBye(nt, usn, localAddr string, opts ...Option) error {
 	if err != nil {
 		return err
 	}
+	uda, err := cfg.udaConfig.header(false)
+	if err != nil {
+		return err
+	}
 	// dial multicast UDP packet.
-	conn, err := multicast.Listen(&multicast.AddrResolver{Addr: localAddr}, cfg.multicastConfig.options()...)
+	conn, err := cfg.multicastConfig.transport().ListenUnicast(localAddr)
 	if err != nil {
 		return err
 	}
 	defer conn.Close()
-	// build and send message.
-	addr, err := multicast.SendAddr()
+	// build and send message for each multicast groups.
+	for _, addr := range conn.Groups() {
+		msg, err := buildBye(addr, nt, usn, uda)
+		if err != nil {
+			return err
+		}
+		if _, err := conn.WriteTo(bytesData(msg), addr, nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func buildBye(raddr net.Addr, nt, usn string, uda udaHeader) ([]byte, error) {
+	m := &Notify{
+		Host:   raddr.String(),
+		NT:     nt,
+		NTS:    NTSByebye,
+		USN:    usn,
+		Fields: uda.fields(),
+	}
+	return m.Marshal(), nil
+}
+
+// AnnounceUpdate sends ssdp:update message.
+// location should be a string or a ssdp.LocationProvider.
+// BOOTID should be given by BootID() or BootIDFrom() option, and nextBootID
+// is a BOOTID which will be used after this.
+func AnnounceUpdate(nt, usn string, location any, nextBootID int, localAddr string, opts ...Option) error {
+	locProv, err := toLocationProvider(location)
 	if err != nil {
 		return err
 	}
-	msg, err := buildBye(addr, nt, usn)
+	cfg, err := opts2config(opts)
 	if err != nil {
 		return err
 	}
-	if _, err := conn.WriteTo(multicast.BytesDataProvider(msg), addr); err != nil {
+	uda, err := cfg.udaConfig.header(false)
+	if err != nil {
 		return err
 	}
+	if uda.bootID < 0 {
+		return ErrNoBootID
+	}
+	// dial multicast UDP packet.
+	conn, err := cfg.multicastConfig.transport().ListenUnicast(localAddr)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	// build and send message for each multicast groups.
+	for _, addr := range conn.Groups() {
+		msg := &updateDataProvider{
+			host:       addr,
+			nt:         nt,
+			usn:        usn,
+			location:   locProv,
+			addrsOf:    interfaceAddrsOf(conn),
+			uda:        uda,
+			nextBootID: nextBootID,
+		}
+		if _, err := conn.WriteTo(msg.Bytes, addr, nil); err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
-func buildBye(raddr net.Addr, nt, usn string) ([]byte, error) {
-	b := new(bytes.Buffer)
-	// FIXME: error should be checked.
-	b.WriteString("NOTIFY * HTTP/1.1\r\n")
-	fmt.Fprintf(b, "HOST: %s\r\n", raddr.String())
-	fmt.Fprintf(b, "NT: %s\r\n", nt)
-	fmt.Fprintf(b, "NTS: %s\r\n", "ssdp:byebye")
-	fmt.Fprintf(b, "USN: %s\r\n", usn)
-	b.WriteString("\r\n")
-	return b.Bytes(), nil
+type updateDataProvider struct {
+	host       net.Addr
+	nt         string
+	usn        string
+	location   LocationProvider
+	addrsOf    func(*net.Interface) ([]net.Addr, error)
+	uda        udaHeader
+	nextBootID int
+}
+
+func (p *updateDataProvider) Bytes(ifi *net.Interface) []byte {
+	return buildUpdate(p.host, p.nt, p.usn, location(p.location, p.addrsOf, nil, ifi), p.uda, p.nextBootID)
+}
+
+func buildUpdate(raddr net.Addr, nt, usn, location string, uda udaHeader, nextBootID int) []byte {
+	m := &Notify{
+		Host:     raddr.String(),
+		NT:       nt,
+		NTS:      NTSUpdate,
+		USN:      usn,
+		Location: location,
+		Fields:   uda.fields(),
+	}
+	m.Fields.Add(hdrNextBootID, strconv.Itoa(nextBootID))
+	return m.Marshal()
 }
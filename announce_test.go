@@ -97,3 +97,78 @@ func TestAnnounceBye(t *testing.T) {
 		}
 	}
 }
+
+func TestAnnounceBye_UDAHeaders(t *testing.T) {
+	var mu sync.Mutex
+	var mm []*ByeMessage
+	m := newTestMonitor(t, "test:announce+byeudaheaders", nil, func(m *ByeMessage) {
+		mu.Lock()
+		mm = append(mm, m)
+		mu.Unlock()
+	}, nil)
+
+	err := AnnounceBye("test:announce+byeudaheaders", "usn:announce+byeudaheaders", "", BootID(10), ConfigID(20))
+	if err != nil {
+		t.Fatalf("failed to announce bye: %s", err)
+	}
+
+	time.Sleep(monitorWait)
+	m.Close()
+
+	mu.Lock()
+	t.Cleanup(mu.Unlock)
+
+	if len(mm) < 1 {
+		t.Fatal("no byes detected")
+	}
+	for i, m := range mm {
+		if v := m.BootID(); v != 10 {
+			t.Errorf("unexpected bye#%d BOOTID: want=%d got=%d", i, 10, v)
+		}
+		if v := m.ConfigID(); v != 20 {
+			t.Errorf("unexpected bye#%d CONFIGID: want=%d got=%d", i, 20, v)
+		}
+		if v := m.SearchPort(); v != -1 {
+			t.Errorf("unexpected bye#%d SEARCHPORT: want=%d got=%d", i, -1, v)
+		}
+	}
+}
+
+func TestAnnounceUpdate(t *testing.T) {
+	var mu sync.Mutex
+	var mm []*UpdateMessage
+	m := newTestMonitorWithUpdate(t, "test:announce+update", nil, nil, nil, func(m *UpdateMessage) {
+		mu.Lock()
+		mm = append(mm, m)
+		mu.Unlock()
+	})
+
+	err := AnnounceUpdate("test:announce+update", "usn:announce+update", "location:announce+update", 101, "", BootID(100))
+	if err != nil {
+		t.Fatalf("failed to announce update: %s", err)
+	}
+
+	time.Sleep(monitorWait)
+	m.Close()
+
+	mu.Lock()
+	t.Cleanup(mu.Unlock)
+
+	if len(mm) < 1 {
+		t.Fatal("no updates detected")
+	}
+	for i, m := range mm {
+		if m.USN != "usn:announce+update" {
+			t.Errorf("unexpected update#%d usn: want=%q got=%q", i, "usn:announce+update", m.USN)
+		}
+		if m.Location != "location:announce+update" {
+			t.Errorf("unexpected update#%d location: want=%q got=%q", i, "location:announce+update", m.Location)
+		}
+		if v := m.BootID(); v != 100 {
+			t.Errorf("unexpected update#%d BOOTID: want=%d got=%d", i, 100, v)
+		}
+		if v := m.NextBootID(); v != 101 {
+			t.Errorf("unexpected update#%d NEXTBOOTID: want=%d got=%d", i, 101, v)
+		}
+	}
+}
@@ -0,0 +1,410 @@
+package ssdp
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/koron/go-ssdp/internal/ssdplog"
+)
+
+// CacheEventType is a type of CacheEvent.
+type CacheEventType int
+
+const (
+	// CacheAdded is an event for a service which is found newly.
+	CacheAdded CacheEventType = iota + 1
+
+	// CacheUpdated is an event for a service which changed its properties.
+	CacheUpdated
+
+	// CacheRemoved is an event for a service which sent ssdp:byebye.
+	CacheRemoved
+
+	// CacheExpired is an event for a service which exceeded its max-age.
+	CacheExpired
+)
+
+func (t CacheEventType) String() string {
+	switch t {
+	case CacheAdded:
+		return "added"
+	case CacheUpdated:
+		return "updated"
+	case CacheRemoved:
+		return "removed"
+	case CacheExpired:
+		return "expired"
+	default:
+		return "unknown"
+	}
+}
+
+// CacheEvent represents a change of services in Cache.
+type CacheEvent struct {
+	Type  CacheEventType
+	Entry CacheEntry
+
+	// Seq is a sequence number of the event, which increases in order of
+	// changes.  Events are delivered in this order.
+	Seq uint64
+}
+
+// CacheHandler is handler of CacheEvent.
+type CacheHandler func(*CacheEvent)
+
+// CacheEntry is a service which is kept by Cache.
+type CacheEntry struct {
+	// Type is a property of "NT" or "ST"
+	Type string
+
+	// USN is a property of "USN"
+	USN string
+
+	// Location is a property of "LOCATION"
+	Location string
+
+	// Server is a property of "SERVER"
+	Server string
+
+	// MaxAge is "max-age" value of "CACHE-CONTROL" property.
+	MaxAge int
+
+	// From is a sender of the last message for this service.
+	From net.Addr
+
+	// Interface is a local interface which received the last message.
+	// It is nil when unknown.
+	Interface *net.Interface
+
+	// LastSeen is a time when the last message was received.
+	LastSeen time.Time
+
+	// Expires is a time when this entry expires.
+	Expires time.Time
+
+	rawHeader http.Header
+}
+
+// Header returns all properties in the last message for this service.
+func (e *CacheEntry) Header() http.Header {
+	return e.rawHeader
+}
+
+// BootID extracts a value of "BOOTID.UPNP.ORG" property.
+// This returns -1 when the property is not available.
+func (e *CacheEntry) BootID() int {
+	return headerInt(e.rawHeader, hdrBootID)
+}
+
+// ConfigID extracts a value of "CONFIGID.UPNP.ORG" property.
+// This returns -1 when the property is not available.
+func (e *CacheEntry) ConfigID() int {
+	return headerInt(e.rawHeader, hdrConfigID)
+}
+
+// changed checks properties of the entry are changed from e or not.
+func (e *CacheEntry) changed(f *CacheEntry) bool {
+	return e.Type != f.Type || e.Location != f.Location ||
+		e.Server != f.Server || e.BootID() != f.BootID() ||
+		e.ConfigID() != f.ConfigID()
+}
+
+// Cache keeps services which are alive, by monitoring SSDP messages.
+// Services are removed by ssdp:byebye, or when their max-age is exceeded.
+type Cache struct {
+	// Event is called for each change of services.  Calls are serialized.
+	Event CacheHandler
+
+	// SearchType is a search type to seed services by Search on Start.
+	// Search is not done when this is empty.
+	SearchType string
+
+	// SearchWait is a time to wait responses of Search in seconds.
+	// 1 is used when this is less than 1.
+	SearchWait int
+
+	// Now returns the current time.  time.Now is used when this is nil.
+	Now func() time.Time
+
+	// ExpireInterval is an interval to check expiration of services.
+	// 1 second is used when this is zero or less.
+	ExpireInterval time.Duration
+
+	Options []Option
+
+	mu      sync.Mutex
+	entries map[string]*CacheEntry
+
+	// events is a queue of events to be delivered, and seq is the last
+	// sequence number of events.  They are guarded by mu, to keep order of
+	// changes.
+	events []*CacheEvent
+	seq    uint64
+
+	// emu serializes calls of Event.
+	emu sync.Mutex
+
+	monitor *Monitor
+	log     *ssdplog.Logger
+	cancel  context.CancelFunc
+	wg      sync.WaitGroup
+}
+
+// Start starts to monitor SSDP messages and to keep services.
+func (c *Cache) Start() error {
+	cfg, err := opts2config(c.Options)
+	if err != nil {
+		return err
+	}
+	c.log = cfg.log
+	// messages for a USN should be handled in order, to keep the latest
+	// state of each service.
+	m := &Monitor{
+		Alive:   c.handleAlive,
+		Bye:     c.handleBye,
+		Update:  c.handleUpdate,
+		Options: append(slices.Clip(c.Options), MonitorOrder(OrderByUSN)),
+	}
+	if err := m.Start(); err != nil {
+		return err
+	}
+	c.monitor = m
+	ctx, cancel := context.WithCancel(context.Background())
+	c.cancel = cancel
+	c.wg.Add(1)
+	go func() {
+		defer c.wg.Done()
+		c.expireMain(ctx)
+	}()
+	if c.SearchType != "" {
+		c.wg.Add(1)
+		go func() {
+			defer c.wg.Done()
+			c.seed(ctx)
+		}()
+	}
+	return nil
+}
+
+// Close stops monitoring, and waits for event handlers which are running.
+// It must not be called from them.  Kept services are still available.
+func (c *Cache) Close() error {
+	if c.monitor == nil {
+		return nil
+	}
+	c.cancel()
+	c.monitor.Close()
+	c.monitor.Wait()
+	c.wg.Wait()
+	c.monitor = nil
+	return nil
+}
+
+// Snapshot returns all services which are alive, sorted by USN.
+func (c *Cache) Snapshot() []CacheEntry {
+	c.mu.Lock()
+	list := make([]CacheEntry, 0, len(c.entries))
+	for _, e := range c.entries {
+		list = append(list, *e)
+	}
+	c.mu.Unlock()
+	slices.SortFunc(list, func(a, b CacheEntry) int {
+		return strings.Compare(a.USN, b.USN)
+	})
+	return list
+}
+
+// Lookup returns a service which has the USN.
+func (c *Cache) Lookup(usn string) (CacheEntry, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.entries[usn]
+	if !ok {
+		return CacheEntry{}, false
+	}
+	return *e, true
+}
+
+// Expire removes services which exceeded their max-age, and emits
+// CacheExpired events for them.  Cache calls this periodically, so it is
+// not required to call this usually.
+func (c *Cache) Expire() {
+	now := c.now()
+	var expired []*CacheEntry
+	c.mu.Lock()
+	for usn, e := range c.entries {
+		if now.Before(e.Expires) {
+			continue
+		}
+		delete(c.entries, usn)
+		expired = append(expired, e)
+	}
+	slices.SortFunc(expired, func(a, b *CacheEntry) int {
+		return strings.Compare(a.USN, b.USN)
+	})
+	for _, e := range expired {
+		c.enqueue(CacheExpired, *e)
+	}
+	c.mu.Unlock()
+	c.emit()
+}
+
+func (c *Cache) now() time.Time {
+	if c.Now != nil {
+		return c.Now()
+	}
+	return time.Now()
+}
+
+func (c *Cache) expireMain(ctx context.Context) {
+	d := c.ExpireInterval
+	if d <= 0 {
+		d = time.Second
+	}
+	t := time.NewTicker(d)
+	defer t.Stop()
+	for {
+		select {
+		case <-t.C:
+			c.Expire()
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// seed searches services to fill the cache.
+func (c *Cache) seed(ctx context.Context) {
+	wait := c.SearchWait
+	if wait < 1 {
+		wait = 1
+	}
+	err := SearchFunc(ctx, c.SearchType, wait, "", func(srv *Service) bool {
+		c.handleService(srv)
+		return true
+	}, c.Options...)
+	if err != nil && ctx.Err() == nil {
+		c.log.Error("failed to search to seed cache", ssdplog.KeyEvent, "search", ssdplog.KeyST, c.SearchType, ssdplog.KeyError, err)
+	}
+}
+
+func (c *Cache) handleAlive(m *AliveMessage) {
+	c.put(&CacheEntry{
+		Type:      m.Type,
+		USN:       m.USN,
+		Location:  m.Location,
+		Server:    m.Server,
+		MaxAge:    m.MaxAge(),
+		From:      m.From,
+		Interface: m.Interface,
+		rawHeader: m.rawHeader,
+	})
+}
+
+func (c *Cache) handleService(srv *Service) {
+	c.put(&CacheEntry{
+		Type:      srv.Type,
+		USN:       srv.USN,
+		Location:  srv.Location,
+		Server:    srv.Server,
+		MaxAge:    srv.MaxAge(),
+		From:      srv.From,
+		Interface: srv.Interface,
+		rawHeader: srv.rawHeader,
+	})
+}
+
+// handleUpdate updates a known service by ssdp:update.  Unknown services
+// are ignored, because ssdp:update has no max-age.
+func (c *Cache) handleUpdate(m *UpdateMessage) {
+	c.mu.Lock()
+	old, ok := c.entries[m.USN]
+	if !ok {
+		c.mu.Unlock()
+		return
+	}
+	e := *old
+	e.Location = m.Location
+	e.From = m.From
+	e.Interface = m.Interface
+	e.rawHeader = m.rawHeader
+	c.entries[m.USN] = &e
+	c.enqueue(CacheUpdated, e)
+	c.mu.Unlock()
+	c.emit()
+}
+
+func (c *Cache) handleBye(m *ByeMessage) {
+	c.mu.Lock()
+	e, ok := c.entries[m.USN]
+	if ok {
+		delete(c.entries, m.USN)
+		c.enqueue(CacheRemoved, *e)
+	}
+	c.mu.Unlock()
+	c.emit()
+}
+
+// put adds or refreshes a service.
+func (c *Cache) put(e *CacheEntry) {
+	if e.USN == "" {
+		return
+	}
+	if e.MaxAge < 0 {
+		e.MaxAge = defaultMaxAge
+	}
+	e.LastSeen = c.now()
+	e.Expires = e.LastSeen.Add(time.Duration(e.MaxAge) * time.Second)
+
+	c.mu.Lock()
+	if c.entries == nil {
+		c.entries = map[string]*CacheEntry{}
+	}
+	old, ok := c.entries[e.USN]
+	c.entries[e.USN] = e
+	switch {
+	case !ok:
+		c.enqueue(CacheAdded, *e)
+	case old.changed(e):
+		c.enqueue(CacheUpdated, *e)
+	}
+	c.mu.Unlock()
+	c.emit()
+}
+
+// enqueue queues an event for a change with a sequence number.  It should
+// be called with mu locked, in the same critical section as the change.
+func (c *Cache) enqueue(t CacheEventType, e CacheEntry) {
+	if c.Event == nil {
+		return
+	}
+	c.seq++
+	c.events = append(c.events, &CacheEvent{Type: t, Entry: e, Seq: c.seq})
+}
+
+// emit delivers queued events in order of their sequence numbers.
+func (c *Cache) emit() {
+	h := c.Event
+	if h == nil {
+		return
+	}
+	c.emu.Lock()
+	defer c.emu.Unlock()
+	for {
+		c.mu.Lock()
+		events := c.events
+		c.events = nil
+		c.mu.Unlock()
+		if len(events) == 0 {
+			return
+		}
+		for _, ev := range events {
+			h(ev)
+		}
+	}
+}
@@ -0,0 +1,247 @@
+package ssdp
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+)
+
+type testClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func (c *testClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *testClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	c.now = c.now.Add(d)
+	c.mu.Unlock()
+}
+
+type testCacheEvents struct {
+	mu     sync.Mutex
+	events []string
+}
+
+func (r *testCacheEvents) handle(ev *CacheEvent) {
+	r.mu.Lock()
+	r.events = append(r.events, ev.Type.String()+" "+ev.Entry.USN)
+	r.mu.Unlock()
+}
+
+func (r *testCacheEvents) take() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	events := r.events
+	r.events = nil
+	return events
+}
+
+func testAliveMessage(usn, location string, maxAge string) *AliveMessage {
+	h := http.Header{}
+	h.Set("CACHE-CONTROL", "max-age="+maxAge)
+	return &AliveMessage{
+		Type:      "test:cache",
+		USN:       usn,
+		Location:  location,
+		rawHeader: h,
+	}
+}
+
+func checkEvents(t *testing.T, r *testCacheEvents, want ...string) {
+	t.Helper()
+	got := r.take()
+	if len(got) != len(want) {
+		t.Fatalf("unexpected events:\nwant=%q\n got=%q", want, got)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("unexpected events:\nwant=%q\n got=%q", want, got)
+		}
+	}
+}
+
+func TestCache_Events(t *testing.T) {
+	clock := &testClock{now: time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)}
+	r := &testCacheEvents{}
+	c := &Cache{Event: r.handle, Now: clock.Now}
+
+	c.handleAlive(testAliveMessage("usn:cache+1", "location:1", "10"))
+	c.handleAlive(testAliveMessage("usn:cache+2", "location:2", "20"))
+	checkEvents(t, r, "added usn:cache+1", "added usn:cache+2")
+
+	// refresh without changes.
+	clock.Advance(5 * time.Second)
+	c.handleAlive(testAliveMessage("usn:cache+1", "location:1", "10"))
+	checkEvents(t, r)
+
+	// change location.
+	c.handleAlive(testAliveMessage("usn:cache+2", "location:2b", "20"))
+	checkEvents(t, r, "updated usn:cache+2")
+	c.handleUpdate(&UpdateMessage{USN: "usn:cache+2", Location: "location:2c", rawHeader: http.Header{}})
+	checkEvents(t, r, "updated usn:cache+2")
+	if e, ok := c.Lookup("usn:cache+2"); !ok || e.Location != "location:2c" {
+		t.Errorf("unexpected entry: %+v", e)
+	}
+
+	// ssdp:update for unknown services is ignored.
+	c.handleUpdate(&UpdateMessage{USN: "usn:cache+3", rawHeader: http.Header{}})
+	checkEvents(t, r)
+
+	// not expired yet.
+	clock.Advance(9 * time.Second)
+	c.Expire()
+	checkEvents(t, r)
+
+	// usn:cache+1 was refreshed at 5s, so it expires at 15s.
+	clock.Advance(1 * time.Second)
+	c.Expire()
+	checkEvents(t, r, "expired usn:cache+1")
+	if _, ok := c.Lookup("usn:cache+1"); ok {
+		t.Error("expired entry is found")
+	}
+
+	c.handleBye(&ByeMessage{USN: "usn:cache+2"})
+	checkEvents(t, r, "removed usn:cache+2")
+	c.handleBye(&ByeMessage{USN: "usn:cache+2"})
+	checkEvents(t, r)
+
+	if list := c.Snapshot(); len(list) != 0 {
+		t.Errorf("cache should be empty: %+v", list)
+	}
+}
+
+func TestCache_EventOrder(t *testing.T) {
+	var (
+		present bool
+		lastSeq uint64
+		bad     []string
+	)
+	c := &Cache{}
+	c.Event = func(ev *CacheEvent) {
+		// calls are serialized.
+		if ev.Seq != lastSeq+1 {
+			bad = append(bad, fmt.Sprintf("seq %d after %d", ev.Seq, lastSeq))
+		}
+		lastSeq = ev.Seq
+		switch ev.Type {
+		case CacheAdded:
+			if present {
+				bad = append(bad, "added twice")
+			}
+			present = true
+		case CacheRemoved:
+			if !present {
+				bad = append(bad, "removed before added")
+			}
+			present = false
+		}
+	}
+	var wg sync.WaitGroup
+	for i := range 200 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if i%2 == 0 {
+				c.handleAlive(testAliveMessage("uuid:order", "http://192.0.2.1/", "1800"))
+			} else {
+				c.handleBye(&ByeMessage{USN: "uuid:order"})
+			}
+		}()
+	}
+	wg.Wait()
+	if len(bad) > 0 {
+		t.Errorf("events are out of order: %v", bad)
+	}
+	if _, ok := c.Lookup("uuid:order"); ok != present {
+		t.Errorf("last event mismatches with the cache: present=%t in cache=%t", present, ok)
+	}
+}
+
+func TestCache_Snapshot(t *testing.T) {
+	clock := &testClock{now: time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)}
+	c := &Cache{Now: clock.Now}
+	c.handleAlive(testAliveMessage("usn:cache+b", "location:b", "10"))
+	c.handleAlive(testAliveMessage("usn:cache+a", "location:a", "bad"))
+
+	list := c.Snapshot()
+	if len(list) != 2 {
+		t.Fatalf("unexpected number of entries: want=%d got=%d", 2, len(list))
+	}
+	if list[0].USN != "usn:cache+a" || list[1].USN != "usn:cache+b" {
+		t.Errorf("entries are not sorted: %q, %q", list[0].USN, list[1].USN)
+	}
+	// default max-age is used when it is not available.
+	if list[0].MaxAge != defaultMaxAge {
+		t.Errorf("unexpected max-age: want=%d got=%d", defaultMaxAge, list[0].MaxAge)
+	}
+	if want := clock.now.Add(10 * time.Second); !list[1].Expires.Equal(want) {
+		t.Errorf("unexpected expires: want=%s got=%s", want, list[1].Expires)
+	}
+}
+
+func TestCache_Monitor(t *testing.T) {
+	a, err := Advertise("test:cache+monitor", "usn:cache+monitor", "location:cache+monitor", "server:cache+monitor", 600)
+	if err != nil {
+		t.Fatalf("failed to Advertise: %s", err)
+	}
+	t.Cleanup(func() {
+		a.Close()
+	})
+
+	added := make(chan struct{}, 1)
+	removed := make(chan struct{}, 1)
+	c := &Cache{
+		SearchType: "test:cache+monitor",
+		Event: func(ev *CacheEvent) {
+			if ev.Entry.USN != "usn:cache+monitor" {
+				return
+			}
+			switch ev.Type {
+			case CacheAdded:
+				added <- struct{}{}
+			case CacheRemoved:
+				removed <- struct{}{}
+			}
+		},
+	}
+	if err := c.Start(); err != nil {
+		t.Fatalf("failed to start Cache: %s", err)
+	}
+	t.Cleanup(func() {
+		c.Close()
+	})
+	if got := c.monitor.cfg.order; got != OrderByUSN {
+		t.Errorf("monitor of Cache should deliver messages by USN: %d", got)
+	}
+
+	// seeded by Search.
+	select {
+	case <-added:
+	case <-time.After(2 * time.Second):
+		t.Fatal("service is not added")
+	}
+	e, ok := c.Lookup("usn:cache+monitor")
+	if !ok {
+		t.Fatal("service is not found")
+	}
+	if e.Location != "location:cache+monitor" || e.MaxAge != 600 {
+		t.Errorf("unexpected entry: %+v", e)
+	}
+
+	if err := a.Bye(); err != nil {
+		t.Fatalf("failed to send bye: %s", err)
+	}
+	select {
+	case <-removed:
+	case <-time.After(2 * time.Second):
+		t.Fatal("service is not removed")
+	}
+}
@@ -0,0 +1,292 @@
+package ssdp
+
+import (
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Description is a UPnP device description which is provided at LOCATION.
+type Description struct {
+	// Location is an URL where the description is fetched.
+	Location string `xml:"-"`
+
+	// ConfigID is a value of "configId" attribute.  It is zero when
+	// omitted.
+	ConfigID int `xml:"configId,attr"`
+
+	SpecVersion SpecVersion `xml:"specVersion"`
+
+	// URLBase is a base URL for relative URLs in the description.
+	// Deprecated by UPnP Device Architecture 1.1, but some devices have it.
+	URLBase string `xml:"URLBase"`
+
+	Device DeviceDescription `xml:"device"`
+}
+
+// SpecVersion is a version of UPnP Device Architecture.
+type SpecVersion struct {
+	Major int `xml:"major"`
+	Minor int `xml:"minor"`
+}
+
+// DeviceDescription describes a device in Description.
+type DeviceDescription struct {
+	DeviceType       string `xml:"deviceType"`
+	FriendlyName     string `xml:"friendlyName"`
+	Manufacturer     string `xml:"manufacturer"`
+	ManufacturerURL  string `xml:"manufacturerURL"`
+	ModelDescription string `xml:"modelDescription"`
+	ModelName        string `xml:"modelName"`
+	ModelNumber      string `xml:"modelNumber"`
+	ModelURL         string `xml:"modelURL"`
+	SerialNumber     string `xml:"serialNumber"`
+	UDN              string `xml:"UDN"`
+	UPC              string `xml:"UPC"`
+
+	Icons    []Icon               `xml:"iconList>icon"`
+	Services []ServiceDescription `xml:"serviceList>service"`
+	Devices  []DeviceDescription  `xml:"deviceList>device"`
+
+	PresentationURL string `xml:"presentationURL"`
+}
+
+// Icon describes an icon of a device.
+type Icon struct {
+	Mimetype string `xml:"mimetype"`
+	Width    int    `xml:"width"`
+	Height   int    `xml:"height"`
+	Depth    int    `xml:"depth"`
+	URL      string `xml:"url"`
+}
+
+// ServiceDescription describes a service of a device.
+type ServiceDescription struct {
+	ServiceType string `xml:"serviceType"`
+	ServiceID   string `xml:"serviceId"`
+	SCPDURL     string `xml:"SCPDURL"`
+	ControlURL  string `xml:"controlURL"`
+	EventSubURL string `xml:"eventSubURL"`
+}
+
+// resolve resolves relative URLs in the device and its embedded devices.
+func (d *DeviceDescription) resolve(base *url.URL) {
+	d.ManufacturerURL = resolveURL(base, d.ManufacturerURL)
+	d.ModelURL = resolveURL(base, d.ModelURL)
+	d.PresentationURL = resolveURL(base, d.PresentationURL)
+	for i := range d.Icons {
+		d.Icons[i].URL = resolveURL(base, d.Icons[i].URL)
+	}
+	for i := range d.Services {
+		s := &d.Services[i]
+		s.SCPDURL = resolveURL(base, s.SCPDURL)
+		s.ControlURL = resolveURL(base, s.ControlURL)
+		s.EventSubURL = resolveURL(base, s.EventSubURL)
+	}
+	for i := range d.Devices {
+		d.Devices[i].resolve(base)
+	}
+}
+
+// hasDevice checks the device or its embedded devices have a UDN.
+func (d *DeviceDescription) hasDevice(udn string) bool {
+	if strings.EqualFold(strings.TrimSpace(d.UDN), udn) {
+		return true
+	}
+	for i := range d.Devices {
+		if d.Devices[i].hasDevice(udn) {
+			return true
+		}
+	}
+	return false
+}
+
+// resolveURL resolves ref with base.  ref is returned as is when it is empty
+// or invalid.
+func resolveURL(base *url.URL, ref string) string {
+	s := strings.TrimSpace(ref)
+	if s == "" {
+		return ref
+	}
+	u, err := url.Parse(s)
+	if err != nil {
+		return ref
+	}
+	return base.ResolveReference(u).String()
+}
+
+const (
+	// defaultDescriptionTimeout is a default timeout to fetch a description.
+	defaultDescriptionTimeout = 10 * time.Second
+
+	// defaultDescriptionSize is a default limit of size of a description.
+	defaultDescriptionSize = 1 << 20
+
+	// maxCachedDescriptions is the maximum number of descriptions which
+	// DescriptionClient caches.  The least recently used one is forgotten
+	// when it is exceeded.
+	maxCachedDescriptions = 1024
+)
+
+// ErrDescriptionTooLarge is returned when a description exceeds MaxSize of
+// DescriptionClient.
+var ErrDescriptionTooLarge = errors.New("description is too large")
+
+// DescriptionClient fetches UPnP device descriptions from LOCATION.
+// Relative URLs in descriptions are resolved with URLBase or LOCATION.
+type DescriptionClient struct {
+	// Client is a HTTP client to fetch descriptions.  http.DefaultClient is
+	// used when this is nil.
+	Client *http.Client
+
+	// Timeout is a timeout to fetch a description.  10 seconds is used when
+	// this is zero or less.
+	Timeout time.Duration
+
+	// MaxSize is a limit of size of a description in bytes.  1 MiB is used
+	// when this is zero or less.
+	MaxSize int64
+
+	// cache is cached descriptions by location.  used counts uses of them
+	// to find the least recently used one.
+	mu    sync.Mutex
+	cache map[string]*cachedDescription
+	used  uint64
+}
+
+type cachedDescription struct {
+	configID int
+	desc     *Description
+	used     uint64
+}
+
+// Fetch fetches a description from location.
+func (c *DescriptionClient) Fetch(ctx context.Context, location string) (*Description, error) {
+	timeout := c.Timeout
+	if timeout <= 0 {
+		timeout = defaultDescriptionTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, location, nil)
+	if err != nil {
+		return nil, err
+	}
+	client := c.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to fetch description from %s: %s", location, resp.Status)
+	}
+	maxSize := c.MaxSize
+	if maxSize <= 0 {
+		maxSize = defaultDescriptionSize
+	}
+	if resp.ContentLength > maxSize {
+		return nil, ErrDescriptionTooLarge
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > maxSize {
+		return nil, ErrDescriptionTooLarge
+	}
+	var desc Description
+	if err := xml.Unmarshal(data, &desc); err != nil {
+		return nil, fmt.Errorf("failed to parse description from %s: %w", location, err)
+	}
+	desc.Location = location
+	base := resp.Request.URL
+	if desc.URLBase != "" {
+		if u, err := url.Parse(strings.TrimSpace(desc.URLBase)); err == nil {
+			base = base.ResolveReference(u)
+		}
+	}
+	desc.Device.resolve(base)
+	return &desc, nil
+}
+
+// FetchCached fetches a description from location for a device which is
+// identified by usn, or returns a cached one.  Descriptions are cached by
+// location, and a cached one is used while configID is not changed and it
+// describes the device, as a root or an embedded device.  configID should be
+// negative when CONFIGID.UPNP.ORG is not available.
+// The returned description should not be modified.
+func (c *DescriptionClient) FetchCached(ctx context.Context, usn, location string, configID int) (*Description, error) {
+	udn := deviceUUID(usn)
+	c.mu.Lock()
+	e, ok := c.cache[location]
+	if ok && e.configID == configID && e.desc.Device.hasDevice(udn) {
+		c.used++
+		e.used = c.used
+		c.mu.Unlock()
+		return e.desc, nil
+	}
+	c.mu.Unlock()
+	desc, err := c.Fetch(ctx, location)
+	if err != nil {
+		return nil, err
+	}
+	c.mu.Lock()
+	if c.cache == nil {
+		c.cache = map[string]*cachedDescription{}
+	}
+	if _, ok := c.cache[location]; !ok && len(c.cache) >= maxCachedDescriptions {
+		c.evict()
+	}
+	c.used++
+	c.cache[location] = &cachedDescription{configID: configID, desc: desc, used: c.used}
+	c.mu.Unlock()
+	return desc, nil
+}
+
+// evict removes the least recently used description.  c.mu should be
+// locked.
+func (c *DescriptionClient) evict() {
+	var (
+		oldest string
+		used   uint64
+		found  bool
+	)
+	for k, e := range c.cache {
+		if !found || e.used < used {
+			oldest, used, found = k, e.used, true
+		}
+	}
+	delete(c.cache, oldest)
+}
+
+// Forget removes cached descriptions of a device which is identified by usn.
+// It is useful for ssdp:byebye.
+func (c *DescriptionClient) Forget(usn string) {
+	udn := deviceUUID(usn)
+	c.mu.Lock()
+	for k, e := range c.cache {
+		if e.desc.Device.hasDevice(udn) {
+			delete(c.cache, k)
+		}
+	}
+	c.mu.Unlock()
+}
+
+// deviceUUID returns "uuid:..." part of USN, which identifies a device.
+func deviceUUID(usn string) string {
+	if n := strings.Index(usn, "::"); n >= 0 {
+		return usn[:n]
+	}
+	return usn
+}
@@ -0,0 +1,209 @@
+package ssdp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+const testDescription = `<?xml version="1.0"?>
+<root xmlns="urn:schemas-upnp-org:device-1-0" configId="7">
+  <specVersion><major>1</major><minor>1</minor></specVersion>
+  <device>
+    <deviceType>urn:schemas-upnp-org:device:MediaServer:1</deviceType>
+    <friendlyName>Test Server</friendlyName>
+    <manufacturer>go-ssdp</manufacturer>
+    <modelName>test</modelName>
+    <UDN>uuid:11111111-2222-3333-4444-555555555555</UDN>
+    <iconList>
+      <icon><mimetype>image/png</mimetype><width>48</width><height>48</height><depth>24</depth><url>/icon.png</url></icon>
+    </iconList>
+    <serviceList>
+      <service>
+        <serviceType>urn:schemas-upnp-org:service:ContentDirectory:1</serviceType>
+        <serviceId>urn:upnp-org:serviceId:ContentDirectory</serviceId>
+        <SCPDURL>cds.xml</SCPDURL>
+        <controlURL>/cds/control</controlURL>
+        <eventSubURL>/cds/event</eventSubURL>
+      </service>
+    </serviceList>
+    <deviceList>
+      <device>
+        <deviceType>urn:schemas-upnp-org:device:Basic:1</deviceType>
+        <UDN>uuid:66666666-7777-8888-9999-000000000000</UDN>
+        <presentationURL>/embedded/</presentationURL>
+      </device>
+    </deviceList>
+    <presentationURL>http://192.0.2.1/</presentationURL>
+  </device>
+</root>`
+
+func newDescriptionServer(t *testing.T, body string) (*httptest.Server, *atomic.Int32) {
+	t.Helper()
+	var hits atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		switch r.URL.Path {
+		case "/dev/desc.xml":
+			w.Header().Set("Content-Type", "text/xml")
+			w.Write([]byte(body))
+		case "/slow.xml":
+			time.Sleep(200 * time.Millisecond)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &hits
+}
+
+func TestDescriptionClient_Fetch(t *testing.T) {
+	srv, _ := newDescriptionServer(t, testDescription)
+	c := &DescriptionClient{}
+	desc, err := c.Fetch(context.Background(), srv.URL+"/dev/desc.xml")
+	if err != nil {
+		t.Fatalf("failed to fetch: %s", err)
+	}
+	if desc.ConfigID != 7 || desc.SpecVersion != (SpecVersion{1, 1}) {
+		t.Errorf("unexpected root: %+v", desc)
+	}
+	d := desc.Device
+	if d.FriendlyName != "Test Server" || d.UDN != "uuid:11111111-2222-3333-4444-555555555555" {
+		t.Errorf("unexpected device: %+v", d)
+	}
+	if len(d.Icons) != 1 || d.Icons[0].URL != srv.URL+"/icon.png" || d.Icons[0].Width != 48 {
+		t.Errorf("unexpected icons: %+v", d.Icons)
+	}
+	want := ServiceDescription{
+		ServiceType: "urn:schemas-upnp-org:service:ContentDirectory:1",
+		ServiceID:   "urn:upnp-org:serviceId:ContentDirectory",
+		SCPDURL:     srv.URL + "/dev/cds.xml",
+		ControlURL:  srv.URL + "/cds/control",
+		EventSubURL: srv.URL + "/cds/event",
+	}
+	if len(d.Services) != 1 || d.Services[0] != want {
+		t.Errorf("unexpected services: %+v", d.Services)
+	}
+	if len(d.Devices) != 1 || d.Devices[0].PresentationURL != srv.URL+"/embedded/" {
+		t.Errorf("unexpected embedded devices: %+v", d.Devices)
+	}
+	if d.PresentationURL != "http://192.0.2.1/" {
+		t.Errorf("unexpected presentation URL: %s", d.PresentationURL)
+	}
+}
+
+func TestDescriptionClient_URLBase(t *testing.T) {
+	body := strings.Replace(testDescription, "<device>", "<URLBase>http://192.0.2.10:8080/base/</URLBase><device>", 1)
+	srv, _ := newDescriptionServer(t, body)
+	desc, err := (&DescriptionClient{}).Fetch(context.Background(), srv.URL+"/dev/desc.xml")
+	if err != nil {
+		t.Fatalf("failed to fetch: %s", err)
+	}
+	if got, want := desc.Device.Services[0].SCPDURL, "http://192.0.2.10:8080/base/cds.xml"; got != want {
+		t.Errorf("unexpected SCPDURL: want=%s got=%s", want, got)
+	}
+}
+
+func TestDescriptionClient_Error(t *testing.T) {
+	srv, _ := newDescriptionServer(t, testDescription)
+	for i, tc := range []struct {
+		c    *DescriptionClient
+		path string
+		err  error
+	}{
+		{&DescriptionClient{}, "/notfound.xml", nil},
+		{&DescriptionClient{MaxSize: 100}, "/dev/desc.xml", ErrDescriptionTooLarge},
+		{&DescriptionClient{Timeout: 50 * time.Millisecond}, "/slow.xml", context.DeadlineExceeded},
+	} {
+		_, err := tc.c.Fetch(context.Background(), srv.URL+tc.path)
+		if err == nil {
+			t.Errorf("#%d fetch should fail", i)
+			continue
+		}
+		if tc.err != nil && !errors.Is(err, tc.err) {
+			t.Errorf("#%d unexpected error: %s", i, err)
+		}
+	}
+}
+
+func TestDescriptionClient_FetchCached(t *testing.T) {
+	srv, hits := newDescriptionServer(t, testDescription)
+	location := srv.URL + "/dev/desc.xml"
+	c := &DescriptionClient{}
+	ctx := context.Background()
+	const (
+		root     = "uuid:11111111-2222-3333-4444-555555555555"
+		embedded = "uuid:66666666-7777-8888-9999-000000000000"
+	)
+	for i, tc := range []struct {
+		usn      string
+		configID int
+		hits     int32
+	}{
+		{root + "::upnp:rootdevice", 7, 1},
+		// same device with other USN.
+		{root + "::urn:schemas-upnp-org:device:MediaServer:1", 7, 1},
+		// embedded device shares the description.
+		{embedded, 7, 1},
+		// other device at same location.
+		{"uuid:other", 7, 2},
+		{root, 7, 2},
+		// CONFIGID is changed.
+		{root, 8, 3},
+		{root, 8, 3},
+		// no CONFIGID.
+		{root, -1, 4},
+		{embedded, -1, 4},
+	} {
+		if _, err := c.FetchCached(ctx, tc.usn, location, tc.configID); err != nil {
+			t.Fatalf("#%d failed to fetch: %s", i, err)
+		}
+		if got := hits.Load(); got != tc.hits {
+			t.Errorf("#%d unexpected number of requests: want=%d got=%d", i, tc.hits, got)
+		}
+	}
+	c.Forget(embedded + "::urn:schemas-upnp-org:device:Basic:1")
+	if _, err := c.FetchCached(ctx, root, location, -1); err != nil {
+		t.Fatalf("failed to fetch: %s", err)
+	}
+	if got := hits.Load(); got != 5 {
+		t.Errorf("description should be fetched after Forget: hits=%d", got)
+	}
+}
+
+func TestDescriptionClient_Evict(t *testing.T) {
+	srv, hits := newDescriptionServer(t, testDescription)
+	const usn = "uuid:11111111-2222-3333-4444-555555555555"
+	c := &DescriptionClient{}
+	ctx := context.Background()
+	fetch := func(i int) {
+		t.Helper()
+		if _, err := c.FetchCached(ctx, usn, fmt.Sprintf("%s/dev/desc.xml?%d", srv.URL, i), 7); err != nil {
+			t.Fatalf("failed to fetch #%d: %s", i, err)
+		}
+	}
+	for i := range maxCachedDescriptions {
+		fetch(i)
+	}
+	// use the first, then the second is the least recently used.
+	fetch(0)
+	fetch(maxCachedDescriptions)
+	if got := hits.Load(); got != maxCachedDescriptions+1 {
+		t.Errorf("unexpected number of requests: want=%d got=%d", maxCachedDescriptions+1, got)
+	}
+	if n := len(c.cache); n != maxCachedDescriptions {
+		t.Errorf("unexpected number of cached descriptions: want=%d got=%d", maxCachedDescriptions, n)
+	}
+	if _, ok := c.cache[fmt.Sprintf("%s/dev/desc.xml?%d", srv.URL, 1)]; ok {
+		t.Error("the least recently used description should be evicted")
+	}
+	if _, ok := c.cache[fmt.Sprintf("%s/dev/desc.xml?%d", srv.URL, 0)]; !ok {
+		t.Error("the recently used description should be kept")
+	}
+}
@@ -0,0 +1,87 @@
+package ssdp
+
+import (
+	"errors"
+	"strings"
+)
+
+// Device describes a UPnP device to advertise, with its services and
+// embedded devices.
+type Device struct {
+	// UUID is an UUID of the device. "uuid:" prefix can be omitted.
+	UUID string
+
+	// Type is a device type, like "urn:schemas-upnp-org:device:MediaServer:1".
+	Type string
+
+	// Services is a list of service types which the device provides, like
+	// "urn:schemas-upnp-org:service:ContentDirectory:1".
+	Services []string
+
+	// Devices is a list of embedded devices.
+	Devices []Device
+}
+
+// AdvertiseDevice starts advertisement of a root device, and its embedded
+// devices and services.
+// It advertises all combinations of NT and USN required by UPnP Device
+// Architecture: "upnp:rootdevice" for the root device, UUID and device type
+// for each device, and each service type for each device.
+// location should be a string or a ssdp.LocationProvider.
+func AdvertiseDevice(root *Device, location any, server string, maxAge int, opts ...Option) (*Advertiser, error) {
+	targets, err := root.targets(location, server, maxAge)
+	if err != nil {
+		return nil, err
+	}
+	return advertise(targets, opts)
+}
+
+// targets returns all targets to advertise for the root device.
+func (d *Device) targets(location any, server string, maxAge int) ([]target, error) {
+	pairs, err := d.pairs()
+	if err != nil {
+		return nil, err
+	}
+	return newTargets(pairs, location, server, maxAge)
+}
+
+// pairs returns all pairs of NT and USN to advertise for the root device.
+func (d *Device) pairs() ([][2]string, error) {
+	if d == nil {
+		return nil, errors.New("no root devices")
+	}
+	uuid := "uuid:" + strings.TrimPrefix(d.UUID, "uuid:")
+	pairs := [][2]string{{RootDevice, uuid + "::" + RootDevice}}
+	return d.appendPairs(pairs)
+}
+
+// appendPairs appends pairs for the device and its embedded devices.
+func (d *Device) appendPairs(pairs [][2]string) ([][2]string, error) {
+	if d.UUID == "" {
+		return nil, errors.New("device without UUID")
+	}
+	if d.Type == "" {
+		return nil, errors.New("device without type")
+	}
+	uuid := "uuid:" + strings.TrimPrefix(d.UUID, "uuid:")
+	pairs = append(pairs,
+		[2]string{uuid, uuid},
+		[2]string{d.Type, uuid + "::" + d.Type},
+	)
+	seen := map[string]struct{}{}
+	for _, st := range d.Services {
+		if _, ok := seen[st]; ok {
+			continue
+		}
+		seen[st] = struct{}{}
+		pairs = append(pairs, [2]string{st, uuid + "::" + st})
+	}
+	for i := range d.Devices {
+		var err error
+		pairs, err = d.Devices[i].appendPairs(pairs)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return pairs, nil
+}
@@ -0,0 +1,133 @@
+package ssdp
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+var testDevice = &Device{
+	UUID: "11111111-2222-3333-4444-555555555555",
+	Type: "urn:schemas-upnp-org:device:MediaServer:1",
+	Services: []string{
+		"urn:schemas-upnp-org:service:ContentDirectory:1",
+		"urn:schemas-upnp-org:service:ConnectionManager:1",
+		"urn:schemas-upnp-org:service:ContentDirectory:1",
+	},
+	Devices: []Device{
+		{
+			UUID:     "uuid:66666666-7777-8888-9999-000000000000",
+			Type:     "urn:schemas-upnp-org:device:MediaRenderer:1",
+			Services: []string{"urn:schemas-upnp-org:service:ConnectionManager:1"},
+		},
+	},
+}
+
+func TestDevice_Pairs(t *testing.T) {
+	got, err := testDevice.pairs()
+	if err != nil {
+		t.Fatalf("failed to get pairs: %s", err)
+	}
+	want := [][2]string{
+		{"upnp:rootdevice", "uuid:11111111-2222-3333-4444-555555555555::upnp:rootdevice"},
+		{"uuid:11111111-2222-3333-4444-555555555555", "uuid:11111111-2222-3333-4444-555555555555"},
+		{"urn:schemas-upnp-org:device:MediaServer:1", "uuid:11111111-2222-3333-4444-555555555555::urn:schemas-upnp-org:device:MediaServer:1"},
+		{"urn:schemas-upnp-org:service:ContentDirectory:1", "uuid:11111111-2222-3333-4444-555555555555::urn:schemas-upnp-org:service:ContentDirectory:1"},
+		{"urn:schemas-upnp-org:service:ConnectionManager:1", "uuid:11111111-2222-3333-4444-555555555555::urn:schemas-upnp-org:service:ConnectionManager:1"},
+		{"uuid:66666666-7777-8888-9999-000000000000", "uuid:66666666-7777-8888-9999-000000000000"},
+		{"urn:schemas-upnp-org:device:MediaRenderer:1", "uuid:66666666-7777-8888-9999-000000000000::urn:schemas-upnp-org:device:MediaRenderer:1"},
+		{"urn:schemas-upnp-org:service:ConnectionManager:1", "uuid:66666666-7777-8888-9999-000000000000::urn:schemas-upnp-org:service:ConnectionManager:1"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("unexpected pairs:\nwant=%+v\n got=%+v", want, got)
+	}
+}
+
+func TestDevice_PairsInvalid(t *testing.T) {
+	for i, d := range []*Device{
+		nil,
+		{Type: "urn:schemas-upnp-org:device:MediaServer:1"},
+		{UUID: "11111111-2222-3333-4444-555555555555"},
+		{
+			UUID:    "11111111-2222-3333-4444-555555555555",
+			Type:    "urn:schemas-upnp-org:device:MediaServer:1",
+			Devices: []Device{{UUID: "66666666-7777-8888-9999-000000000000"}},
+		},
+	} {
+		if _, err := d.pairs(); err == nil {
+			t.Errorf("#%d pairs() should fail", i)
+		}
+	}
+}
+
+func TestAdvertiser_Match(t *testing.T) {
+	targets, err := testDevice.targets("", "", 0)
+	if err != nil {
+		t.Fatalf("failed to get targets: %s", err)
+	}
+	a := &Advertiser{targets: targets}
+	for i, tc := range []struct {
+		st   string
+		want int
+	}{
+		{All, 8},
+		{RootDevice, 1},
+		{"uuid:66666666-7777-8888-9999-000000000000", 1},
+		{"urn:schemas-upnp-org:service:ConnectionManager:1", 2},
+		{"urn:schemas-upnp-org:service:AVTransport:1", 0},
+	} {
+		if got := a.match(tc.st); len(got) != tc.want {
+			t.Errorf("#%d unexpected number of targets for %q: want=%d got=%d", i, tc.st, tc.want, len(got))
+		}
+	}
+
+	// compatibility: an advertiser without rootdevice responds to it, with
+	// the first target only.
+	a = &Advertiser{targets: []target{
+		{nt: "my:device", usn: "unique:id"},
+		{nt: "my:service1", usn: "unique:id::my:service1"},
+		{nt: "my:service2", usn: "unique:id::my:service2"},
+	}}
+	got := a.match(RootDevice)
+	if len(got) != 1 || got[0].usn != "unique:id" {
+		t.Errorf("unexpected targets for %q: %+v", RootDevice, got)
+	}
+}
+
+func TestAdvertiseDevice_Search(t *testing.T) {
+	a, err := AdvertiseDevice(testDevice, "location:advertisedevice+search", "server:advertisedevice+search", 600)
+	if err != nil {
+		t.Fatalf("failed to AdvertiseDevice: %s", err)
+	}
+	t.Cleanup(func() {
+		a.Close()
+	})
+
+	srvs, err := Search(All, 1, "")
+	if err != nil {
+		t.Fatalf("failed to Search: %s", err)
+	}
+	found := map[string]string{}
+	for _, s := range srvs {
+		if !strings.HasPrefix(s.USN, "uuid:11111111-") && !strings.HasPrefix(s.USN, "uuid:66666666-") {
+			continue
+		}
+		found[s.USN] = s.Type
+	}
+	if len(found) != 8 {
+		t.Errorf("unexpected number of services: want=%d got=%d: %+v", 8, len(found), found)
+	}
+
+	srvs, err = Search("urn:schemas-upnp-org:device:MediaRenderer:1", 1, "")
+	if err != nil {
+		t.Fatalf("failed to Search: %s", err)
+	}
+	if len(srvs) == 0 {
+		t.Fatal("no services found")
+	}
+	for i, s := range srvs {
+		if s.USN != "uuid:66666666-7777-8888-9999-000000000000::urn:schemas-upnp-org:device:MediaRenderer:1" {
+			t.Errorf("unexpected service#%d usn: %q", i, s.USN)
+		}
+	}
+}
@@ -0,0 +1,93 @@
+package ssdp
+
+import (
+	"fmt"
+	"net"
+
+	"github.com/koron/go-ssdp/internal/ssdplog"
+)
+
+// ParseError is reported when a received packet can't be parsed.
+type ParseError struct {
+	// From is a sender of the packet.
+	From net.Addr
+
+	// Raw is the packet.
+	Raw []byte
+
+	Err error
+}
+
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("failed to parse a packet from %s: %s", e.From, e.Err)
+}
+
+func (e *ParseError) Unwrap() error {
+	return e.Err
+}
+
+// UnexpectedMANError is reported when a M-SEARCH has unexpected MAN.
+type UnexpectedMANError struct {
+	// From is a sender of the M-SEARCH.
+	From net.Addr
+
+	// MAN is a property of "MAN".
+	MAN string
+}
+
+func (e *UnexpectedMANError) Error() string {
+	return fmt.Sprintf("unexpected MAN from %s: %s", e.From, e.MAN)
+}
+
+// UnknownNTSError is reported when a NOTIFY has unknown NTS.
+type UnknownNTSError struct {
+	// From is a sender of the NOTIFY.
+	From net.Addr
+
+	// NTS is a property of "NTS".
+	NTS string
+}
+
+func (e *UnknownNTSError) Error() string {
+	return fmt.Sprintf("unknown NTS from %s: %s", e.From, e.NTS)
+}
+
+// ReadError is reported when reading packets failed.  It is fatal, Monitor
+// and Advertiser stop receiving packets, and their Done() are closed.
+type ReadError struct {
+	Err error
+}
+
+func (e *ReadError) Error() string {
+	return fmt.Sprintf("failed to read packets: %s", e.Err)
+}
+
+func (e *ReadError) Unwrap() error {
+	return e.Err
+}
+
+type errorConfig struct {
+	errorHandler func(error)
+}
+
+// errorReporter logs errors and notifies them to ErrorHandler.
+type errorReporter struct {
+	h   func(error)
+	log *ssdplog.Logger
+}
+
+func (r errorReporter) report(event string, err error) {
+	if _, ok := err.(*ReadError); ok {
+		r.log.Error("stopped receiving packets", ssdplog.KeyEvent, event, ssdplog.KeyError, err)
+	} else {
+		r.log.Warn("failed to handle message", ssdplog.KeyEvent, event, ssdplog.KeyError, err)
+	}
+	r.notify(err)
+}
+
+// notify notifies an error to ErrorHandler without logging.
+func (r errorReporter) notify(err error) {
+	if r.h != nil {
+		r.h(err)
+	}
+}
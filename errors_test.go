@@ -0,0 +1,206 @@
+package ssdp
+
+import (
+	"errors"
+	"io"
+	"net"
+	"sync"
+	"testing"
+	"time"
+)
+
+// testTransport is a Transport which provides testConn.
+type testTransport struct {
+	packets [][]byte
+	err     error
+}
+
+func (tr *testTransport) ListenMulticast() (TransportConn, error) {
+	return &testConn{packets: tr.packets, err: tr.err, closed: make(chan struct{})}, nil
+}
+
+func (tr *testTransport) ListenUnicast(string) (TransportConn, error) {
+	return tr.ListenMulticast()
+}
+
+// testConn is a TransportConn which receives packets, then fails with err.
+// It waits Close() when err is nil.
+type testConn struct {
+	packets [][]byte
+	err     error
+	closed  chan struct{}
+	once    sync.Once
+}
+
+var testFrom = &net.UDPAddr{IP: net.IPv4(192, 0, 2, 1), Port: 1900}
+
+func (c *testConn) Groups() []*net.UDPAddr {
+	return []*net.UDPAddr{{IP: net.IPv4(239, 255, 255, 250), Port: 1900}}
+}
+
+func (c *testConn) WriteTo(data func(*net.Interface) []byte, to net.Addr, ifi *net.Interface) (int, error) {
+	return len(data(ifi)), nil
+}
+
+func (c *testConn) ReadPackets(timeout time.Duration, h func(net.Addr, []byte, *net.Interface, net.Addr) error) error {
+	for _, p := range c.packets {
+		if err := h(testFrom, p, nil, nil); err != nil {
+			return err
+		}
+	}
+	if c.err != nil {
+		return c.err
+	}
+	<-c.closed
+	return io.EOF
+}
+
+func (c *testConn) LocalAddr() net.Addr {
+	return &net.UDPAddr{IP: net.IPv4zero, Port: 1900}
+}
+
+func (c *testConn) Close() error {
+	c.once.Do(func() { close(c.closed) })
+	return nil
+}
+
+// errorCollector collects errors which are notified by ErrorHandler.
+type errorCollector struct {
+	mu   sync.Mutex
+	errs []error
+}
+
+func (c *errorCollector) handle(err error) {
+	c.mu.Lock()
+	c.errs = append(c.errs, err)
+	c.mu.Unlock()
+}
+
+// wait waits n errors, and returns them.
+func (c *errorCollector) wait(t *testing.T, n int) []error {
+	t.Helper()
+	var errs []error
+	for range 100 {
+		c.mu.Lock()
+		errs = c.errs
+		c.mu.Unlock()
+		if len(errs) >= n {
+			return errs
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("errors are not notified: want=%d got=%d", n, len(errs))
+	return nil
+}
+
+func TestMonitor_ErrorHandler(t *testing.T) {
+	errRead := errors.New("socket is dead")
+	tr := &testTransport{
+		packets: [][]byte{
+			[]byte("NOTIFY * HTTP/1.1\r\nNT foo\r\n\r\n"),
+			[]byte("NOTIFY * HTTP/1.1\r\nNT: foo\r\nNTS: ssdp:unknown\r\n\r\n"),
+			[]byte("M-SEARCH * HTTP/1.1\r\nMAN: foo\r\nST: ssdp:all\r\n\r\n"),
+		},
+		err: errRead,
+	}
+	var c errorCollector
+	m := &Monitor{Options: []Option{UseTransport(tr), ErrorHandler(c.handle)}}
+	if err := m.Start(); err != nil {
+		t.Fatalf("failed to start Monitor: %s", err)
+	}
+	defer m.Close()
+
+	select {
+	case <-m.Done():
+	case <-time.After(time.Second):
+		t.Fatal("Done() is not closed")
+	}
+	var re *ReadError
+	if err := m.Err(); !errors.As(err, &re) || !errors.Is(err, errRead) {
+		t.Errorf("unexpected Err(): %v", err)
+	}
+
+	var (
+		pe  *ParseError
+		nts *UnknownNTSError
+		man *UnexpectedMANError
+	)
+	errs := c.wait(t, 4)
+	for _, err := range errs {
+		switch {
+		case errors.As(err, &pe):
+			if string(pe.Raw) != string(tr.packets[0]) {
+				t.Errorf("unexpected raw packet: %q", pe.Raw)
+			}
+		case errors.As(err, &nts):
+			if nts.NTS != "ssdp:unknown" {
+				t.Errorf("unexpected NTS: %s", nts.NTS)
+			}
+		case errors.As(err, &man):
+			if man.MAN != "foo" {
+				t.Errorf("unexpected MAN: %s", man.MAN)
+			}
+		case errors.As(err, &re):
+		default:
+			t.Errorf("unexpected error: %s", err)
+		}
+	}
+	if pe == nil || nts == nil || man == nil || re == nil {
+		t.Errorf("some errors are not notified: %v", errs)
+	}
+}
+
+func TestAdvertiser_Done(t *testing.T) {
+	var c errorCollector
+	a, err := Advertise("test:done", "usn:done", "location:done", "", 600,
+		UseTransport(&testTransport{}), ErrorHandler(c.handle))
+	if err != nil {
+		t.Fatalf("failed to advertise: %s", err)
+	}
+	select {
+	case <-a.Done():
+		t.Fatal("Done() is closed before Close()")
+	default:
+	}
+	if err := a.Close(); err != nil {
+		t.Fatalf("failed to close: %s", err)
+	}
+	select {
+	case <-a.Done():
+	default:
+		t.Fatal("Done() is not closed after Close()")
+	}
+	if err := a.Err(); err != nil {
+		t.Errorf("unexpected Err() after Close(): %s", err)
+	}
+	if len(c.errs) != 0 {
+		t.Errorf("unexpected errors: %v", c.errs)
+	}
+}
+
+func TestAdvertiser_ReadError(t *testing.T) {
+	errRead := errors.New("socket is dead")
+	var c errorCollector
+	a, err := Advertise("test:readerror", "usn:readerror", "location:readerror", "", 600,
+		UseTransport(&testTransport{
+			packets: [][]byte{[]byte("M-SEARCH * HTTP/1.1\r\nMAN: foo\r\nST: ssdp:all\r\n\r\n")},
+			err:     errRead,
+		}), ErrorHandler(c.handle))
+	if err != nil {
+		t.Fatalf("failed to advertise: %s", err)
+	}
+	defer a.Close()
+	select {
+	case <-a.Done():
+	case <-time.After(time.Second):
+		t.Fatal("Done() is not closed")
+	}
+	if err := a.Err(); !errors.Is(err, errRead) {
+		t.Errorf("unexpected Err(): %v", err)
+	}
+	errs := c.wait(t, 2)
+	var man *UnexpectedMANError
+	if !errors.As(errs[0], &man) {
+		t.Errorf("unexpected first error: %s", errs[0])
+	}
+}
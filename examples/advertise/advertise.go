@@ -19,6 +19,8 @@ func main() {
 	ai := flag.Int("ai", 10, "alive interval")
 	ttl := flag.Int("ttl", 0, "TTL for outgoing multicast packets")
 	sysIf := flag.Bool("sysif", false, "use system assigned multicast interface")
+	ipv6 := flag.Bool("ipv6", false, "use IPv6 instead of IPv4")
+	dual := flag.Bool("dual", false, "use both IPv4 and IPv6")
 	v := flag.Bool("v", false, "verbose mode")
 	h := flag.Bool("h", false, "show help")
 	flag.Parse()
@@ -37,29 +39,27 @@ func main() {
 	if *sysIf {
 		opts = append(opts, ssdp.OnlySystemInterface())
 	}
+	if *ipv6 {
+		opts = append(opts, ssdp.IPv6())
+	}
+	if *dual {
+		opts = append(opts, ssdp.DualStack())
+	}
+	if *ai > 0 {
+		// Advertiser sends alive periodically, and byebye on Close().
+		opts = append(opts, ssdp.AliveInterval(time.Duration(*ai)*time.Second))
+	}
 
 	ad, err := ssdp.Advertise(*st, *usn, *loc, *srv, *maxAge, opts...)
 	if err != nil {
 		log.Fatal(err)
 	}
-	var aliveTick <-chan time.Time
-	if *ai > 0 {
-		aliveTick = time.Tick(time.Duration(*ai) * time.Second)
-	} else {
-		aliveTick = make(chan time.Time)
-	}
 	quit := make(chan os.Signal, 1)
 	signal.Notify(quit, os.Interrupt)
+	<-quit
 
-loop:
-	for {
-		select {
-		case <-aliveTick:
-			ad.Alive()
-		case <-quit:
-			break loop
-		}
+	if *ai <= 0 {
+		ad.Bye()
 	}
-	ad.Bye()
 	ad.Close()
 }
@@ -17,6 +17,8 @@ func main() {
 	laddr := flag.String("laddr", "", "local address to listen")
 	ttl := flag.Int("ttl", 0, "TTL for outgoing multicast packets")
 	sysIf := flag.Bool("sysif", false, "use system assigned multicast interface")
+	ipv6 := flag.Bool("ipv6", false, "use IPv6 instead of IPv4")
+	dual := flag.Bool("dual", false, "use both IPv4 and IPv6")
 	v := flag.Bool("v", false, "verbose mode")
 	h := flag.Bool("h", false, "show help")
 	flag.Parse()
@@ -36,6 +38,12 @@ func main() {
 	if *sysIf {
 		opts = append(opts, ssdp.OnlySystemInterface())
 	}
+	if *ipv6 {
+		opts = append(opts, ssdp.IPv6())
+	}
+	if *dual {
+		opts = append(opts, ssdp.DualStack())
+	}
 
 	err := ssdp.AnnounceAlive(*nt, *usn, *loc, *srv, *maxAge, *laddr, opts...)
 	if err != nil {
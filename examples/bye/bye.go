@@ -14,6 +14,8 @@ func main() {
 	laddr := flag.String("laddr", "", "local address to listen")
 	ttl := flag.Int("ttl", 0, "TTL for outgoing multicast packets")
 	sysIf := flag.Bool("sysif", false, "use system assigned multicast interface")
+	ipv6 := flag.Bool("ipv6", false, "use IPv6 instead of IPv4")
+	dual := flag.Bool("dual", false, "use both IPv4 and IPv6")
 	v := flag.Bool("v", false, "verbose mode")
 	h := flag.Bool("h", false, "show help")
 	flag.Parse()
@@ -33,6 +35,12 @@ func main() {
 	if *sysIf {
 		opts = append(opts, ssdp.OnlySystemInterface())
 	}
+	if *ipv6 {
+		opts = append(opts, ssdp.IPv6())
+	}
+	if *dual {
+		opts = append(opts, ssdp.DualStack())
+	}
 
 	err := ssdp.AnnounceBye(*nt, *usn, *laddr, opts...)
 	if err != nil {
@@ -16,6 +16,8 @@ func main() {
 	flag.StringVar(&filterType, "filter_type", "", "print only a specified type (ST or NT). default is print all types.")
 	ttl := flag.Int("ttl", 0, "TTL for outgoing multicast packets")
 	sysIf := flag.Bool("sysif", false, "use system assigned multicast interface")
+	ipv6 := flag.Bool("ipv6", false, "use IPv6 instead of IPv4")
+	dual := flag.Bool("dual", false, "use both IPv4 and IPv6")
 	flag.Parse()
 
 	if *h {
@@ -33,11 +35,18 @@ func main() {
 	if *sysIf {
 		opts = append(opts, ssdp.OnlySystemInterface())
 	}
+	if *ipv6 {
+		opts = append(opts, ssdp.IPv6())
+	}
+	if *dual {
+		opts = append(opts, ssdp.DualStack())
+	}
 
 	m := &ssdp.Monitor{
 		Alive:   onAlive,
 		Bye:     onBye,
 		Search:  onSearch,
+		Update:  onUpdate,
 		Options: opts,
 	}
 	if err := m.Start(); err != nil {
@@ -80,3 +89,12 @@ func onSearch(m *ssdp.SearchMessage) {
 
 	log.Printf("Search: From=%s Type=%s", m.From.String(), m.Type)
 }
+
+func onUpdate(m *ssdp.UpdateMessage) {
+	if filterByType(m.Type) {
+		return
+	}
+
+	log.Printf("Update: From=%s Type=%s USN=%s Location=%s BootID=%d NextBootID=%d",
+		m.From.String(), m.Type, m.USN, m.Location, m.BootID(), m.NextBootID())
+}
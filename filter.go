@@ -0,0 +1,96 @@
+package ssdp
+
+import (
+	"fmt"
+	"net"
+	"slices"
+	"strings"
+)
+
+// filterConfig is a configuration to filter sources of received packets.
+type filterConfig struct {
+	allowNets  []*net.IPNet
+	denyNets   []*net.IPNet
+	interfaces []string
+}
+
+// sourceFilter filters received packets by their sources, before parsing
+// them.  A nil sourceFilter accepts all.
+type sourceFilter struct {
+	allow      []*net.IPNet
+	deny       []*net.IPNet
+	interfaces []string
+}
+
+func newSourceFilter(c filterConfig) *sourceFilter {
+	if len(c.allowNets) == 0 && len(c.denyNets) == 0 && len(c.interfaces) == 0 {
+		return nil
+	}
+	return &sourceFilter{
+		allow:      c.allowNets,
+		deny:       c.denyNets,
+		interfaces: c.interfaces,
+	}
+}
+
+// accept checks a packet from src should be handled or not.  Deny lists
+// precede allow lists.
+func (f *sourceFilter) accept(src Source) bool {
+	if f == nil {
+		return true
+	}
+	if len(f.interfaces) > 0 {
+		ifi := src.Interface
+		if ifi == nil {
+			ifi = zoneInterface(src.From)
+		}
+		if ifi == nil || !slices.Contains(f.interfaces, ifi.Name) {
+			return false
+		}
+	}
+	if len(f.allow) == 0 && len(f.deny) == 0 {
+		return true
+	}
+	a, ok := src.From.(*net.UDPAddr)
+	if !ok {
+		return false
+	}
+	if containsIP(f.deny, a.IP) {
+		return false
+	}
+	return len(f.allow) == 0 || containsIP(f.allow, a.IP)
+}
+
+func containsIP(nets []*net.IPNet, ip net.IP) bool {
+	for _, n := range nets {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseNets parses CIDR notations or IP addresses.  An IP address is treated
+// as a network which contains only it.
+func parseNets(list []string) ([]*net.IPNet, error) {
+	nets := make([]*net.IPNet, 0, len(list))
+	for _, s := range list {
+		if !strings.Contains(s, "/") {
+			ip := net.ParseIP(s)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid IP address: %q", s)
+			}
+			if ip4 := ip.To4(); ip4 != nil {
+				ip = ip4
+			}
+			nets = append(nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(len(ip)*8, len(ip)*8)})
+			continue
+		}
+		_, n, err := net.ParseCIDR(s)
+		if err != nil {
+			return nil, err
+		}
+		nets = append(nets, n)
+	}
+	return nets, nil
+}
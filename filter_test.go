@@ -0,0 +1,99 @@
+package ssdp
+
+import (
+	"net"
+	"testing"
+	"time"
+)
+
+func TestSourceFilter(t *testing.T) {
+	newFilter := func(opts ...Option) *sourceFilter {
+		t.Helper()
+		cfg, err := opts2config(opts)
+		if err != nil {
+			t.Fatalf("failed to configure: %s", err)
+		}
+		return newSourceFilter(cfg.filterConfig)
+	}
+	eth0 := &net.Interface{Index: 1, Name: "eth0"}
+	guest := &net.Interface{Index: 2, Name: "guest0"}
+	for i, tc := range []struct {
+		f    *sourceFilter
+		ip   string
+		ifi  *net.Interface
+		want bool
+	}{
+		{newFilter(), "198.51.100.1", nil, true},
+		{newFilter(AllowSources("192.168.0.0/16")), "192.168.1.1", nil, true},
+		{newFilter(AllowSources("192.168.0.0/16")), "192.169.1.1", nil, false},
+		{newFilter(AllowSources("192.168.0.0/16"), DenySources("192.168.10.0/24")), "192.168.10.1", nil, false},
+		{newFilter(DenySources("192.168.10.5")), "192.168.10.5", nil, false},
+		{newFilter(DenySources("192.168.10.5")), "192.168.10.6", nil, true},
+		{newFilter(AllowSources("2001:db8::/32")), "2001:db8::1", nil, true},
+		{newFilter(AllowSources("2001:db8::/32")), "192.0.2.1", nil, false},
+		{newFilter(SourceInterfaces("eth0")), "192.0.2.1", eth0, true},
+		{newFilter(SourceInterfaces("eth0")), "192.0.2.1", guest, false},
+		{newFilter(SourceInterfaces("eth0")), "192.0.2.1", nil, false},
+		{newFilter(SourceInterfaces("eth0"), DenySources("192.0.2.0/24")), "192.0.2.1", eth0, false},
+	} {
+		src := Source{From: &net.UDPAddr{IP: net.ParseIP(tc.ip), Port: 1900}, Interface: tc.ifi}
+		if got := tc.f.accept(src); got != tc.want {
+			t.Errorf("#%d unexpected acceptance for %s: want=%t got=%t", i, tc.ip, tc.want, got)
+		}
+	}
+}
+
+func TestSourceFilter_Invalid(t *testing.T) {
+	for i, opt := range []Option{
+		AllowSources("192.168.0.0/33"),
+		AllowSources("192.168.0"),
+		DenySources("example.com"),
+	} {
+		if _, err := opts2config([]Option{opt}); err == nil {
+			t.Errorf("#%d invalid network should fail", i)
+		}
+	}
+}
+
+func TestAdvertise_Filter(t *testing.T) {
+	// testFrom is 192.0.2.1.
+	packets := [][]byte{newSearchPacket(All), newSearchPacket(All)}
+	a, err := Advertise("test:filter", "usn:filter", "location:filter", "", 600,
+		UseTransport(&testTransport{packets: packets}),
+		DenySources("192.0.2.0/24"))
+	if err != nil {
+		t.Fatalf("failed to advertise: %s", err)
+	}
+	defer a.Close()
+	st := waitAdvertiserStats(t, a, 2)
+	if want := (AdvertiserStats{Filtered: 2}); st != want {
+		t.Errorf("unexpected stats: want=%+v got=%+v", want, st)
+	}
+}
+
+func TestMonitor_Filter(t *testing.T) {
+	packets := [][]byte{newSearchPacket(All), newSearchPacket(All)}
+	m := &Monitor{
+		Search: func(*SearchMessage) {
+			t.Error("filtered M-SEARCH should not be handled")
+		},
+		Options: []Option{
+			UseTransport(&testTransport{packets: packets}),
+			AllowSources("198.51.100.0/24"),
+		},
+	}
+	if err := m.Start(); err != nil {
+		t.Fatalf("failed to start: %s", err)
+	}
+	defer m.Close()
+	var st MonitorStats
+	for range 100 {
+		if st = m.Stats(); st.Filtered >= 2 {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if want := (MonitorStats{Filtered: 2}); st != want {
+		t.Errorf("unexpected stats: want=%+v got=%+v", want, st)
+	}
+}
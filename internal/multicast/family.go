@@ -0,0 +1,128 @@
+package multicast
+
+import (
+	"net"
+	"time"
+
+	"golang.org/x/net/ipv4"
+	"golang.org/x/net/ipv6"
+)
+
+// Family specifies IP address families to multicast.
+type Family int
+
+const (
+	// IPv4 uses IPv4 only.
+	IPv4 Family = 1 << iota
+
+	// IPv6 uses IPv6 only.
+	IPv6
+
+	// DualStack uses both IPv4 and IPv6.
+	DualStack = IPv4 | IPv6
+)
+
+// Has checks f includes g or not.
+func (f Family) Has(g Family) bool {
+	return f&g != 0
+}
+
+// network returns network name for net.ListenUDP.
+func (f Family) network() string {
+	if f == IPv6 {
+		return "udp6"
+	}
+	return "udp4"
+}
+
+// familyOf returns address family of addr.
+func familyOf(addr net.Addr) Family {
+	if uaddr, ok := addr.(*net.UDPAddr); ok && uaddr.IP.To4() == nil && len(uaddr.IP) == net.IPv6len {
+		return IPv6
+	}
+	return IPv4
+}
+
+// packetConn abstracts ipv4.PacketConn and ipv6.PacketConn.
+type packetConn interface {
+	JoinGroup(ifi *net.Interface, group net.Addr) error
+	LeaveGroup(ifi *net.Interface, group net.Addr) error
+	SetMulticastInterface(ifi *net.Interface) error
+	SetMulticastLoopback(on bool) error
+	SetReadDeadline(t time.Time) error
+	Close() error
+
+	setMulticastTTL(ttl int) error
+	setControlMessage() error
+	writeTo(b []byte, dst net.Addr, ifIndex int) (int, error)
+	readFrom(b []byte) (int, PacketInfo, net.Addr, error)
+}
+
+type ipv4Conn struct {
+	*ipv4.PacketConn
+}
+
+func (c ipv4Conn) setMulticastTTL(ttl int) error {
+	return c.SetMulticastTTL(ttl)
+}
+
+func (c ipv4Conn) setControlMessage() error {
+	return c.SetControlMessage(ipv4.FlagInterface|ipv4.FlagDst, true)
+}
+
+func (c ipv4Conn) writeTo(b []byte, dst net.Addr, ifIndex int) (int, error) {
+	if ifIndex <= 0 {
+		return c.WriteTo(b, nil, dst)
+	}
+	return c.WriteTo(b, &ipv4.ControlMessage{IfIndex: ifIndex}, dst)
+}
+
+func (c ipv4Conn) readFrom(b []byte) (int, PacketInfo, net.Addr, error) {
+	n, cm, src, err := c.ReadFrom(b)
+	var info PacketInfo
+	if cm != nil {
+		info.IfIndex = cm.IfIndex
+		if cm.Dst != nil {
+			info.Dst = &net.UDPAddr{IP: cm.Dst}
+		}
+	}
+	return n, info, src, err
+}
+
+type ipv6Conn struct {
+	*ipv6.PacketConn
+}
+
+func (c ipv6Conn) setMulticastTTL(ttl int) error {
+	return c.SetMulticastHopLimit(ttl)
+}
+
+func (c ipv6Conn) setControlMessage() error {
+	return c.SetControlMessage(ipv6.FlagInterface|ipv6.FlagDst, true)
+}
+
+func (c ipv6Conn) writeTo(b []byte, dst net.Addr, ifIndex int) (int, error) {
+	if ifIndex <= 0 {
+		return c.WriteTo(b, nil, dst)
+	}
+	return c.WriteTo(b, &ipv6.ControlMessage{IfIndex: ifIndex}, dst)
+}
+
+func (c ipv6Conn) readFrom(b []byte) (int, PacketInfo, net.Addr, error) {
+	n, cm, src, err := c.ReadFrom(b)
+	var info PacketInfo
+	if cm != nil {
+		info.IfIndex = cm.IfIndex
+		if cm.Dst != nil {
+			info.Dst = &net.UDPAddr{IP: cm.Dst}
+		}
+	}
+	return n, info, src, err
+}
+
+func newPacketConn(conn *net.UDPConn, f Family) packetConn {
+	if f == IPv6 {
+		return ipv6Conn{ipv6.NewPacketConn(conn)}
+	}
+	return ipv4Conn{ipv4.NewPacketConn(conn)}
+}
@@ -10,17 +10,28 @@ type InterfacesProviderFunc func() []net.Interface
 // If no provider are given, all possible interfaces will be used.
 var InterfacesProvider InterfacesProviderFunc
 
+// interfaceAddrs returns unicast addresses of an interface.  It is replaced
+// by tests.
+var interfaceAddrs = (*net.Interface).Addrs
+
 // SystemAssignedInterface indicates use the system assigned multicast interface or not.
 // InterfacesProvider will be ignored when this is true.
 var SystemAssignedInterface bool = false
 
 // interfaces gets list of net.Interface to multicast UDP packet.
-func interfaces() ([]net.Interface, error) {
+// ifis is used when it is not empty, otherwise InterfacesProvider is used.
+func interfaces(f Family, ifis []net.Interface) ([]net.Interface, error) {
+	if len(ifis) > 0 {
+		return ifis, nil
+	}
 	if p := InterfacesProvider; p != nil {
 		if list := p(); len(list) > 0 {
 			return list, nil
 		}
 	}
+	if f == IPv6 {
+		return interfacesIPv6()
+	}
 	return interfacesIPv4()
 }
 
@@ -40,6 +51,22 @@ func interfacesIPv4() ([]net.Interface, error) {
 	return list, nil
 }
 
+// interfacesIPv6 lists net.Interface on IPv6.
+func interfacesIPv6() ([]net.Interface, error) {
+	iflist, err := net.Interfaces()
+	if err != nil {
+		return nil, err
+	}
+	list := make([]net.Interface, 0, len(iflist))
+	for _, ifi := range iflist {
+		if !hasLinkUp(&ifi) || !hasMulticast(&ifi) || !hasIPv6Address(&ifi) {
+			continue
+		}
+		list = append(list, ifi)
+	}
+	return list, nil
+}
+
 // hasLinkUp checks an I/F have link-up or not.
 func hasLinkUp(ifi *net.Interface) bool {
 	return ifi.Flags&net.FlagUp != 0
@@ -52,7 +79,7 @@ func hasMulticast(ifi *net.Interface) bool {
 
 // hasIPv4Address checks an I/F have IPv4 address.
 func hasIPv4Address(ifi *net.Interface) bool {
-	addrs, err := ifi.Addrs()
+	addrs, err := interfaceAddrs(ifi)
 	if err != nil {
 		return false
 	}
@@ -67,3 +94,21 @@ func hasIPv4Address(ifi *net.Interface) bool {
 	}
 	return false
 }
+
+// hasIPv6Address checks an I/F have IPv6 address.
+func hasIPv6Address(ifi *net.Interface) bool {
+	addrs, err := interfaceAddrs(ifi)
+	if err != nil {
+		return false
+	}
+	for _, a := range addrs {
+		ip, _, err := net.ParseCIDR(a.String())
+		if err != nil {
+			continue
+		}
+		if ip.To4() == nil && len(ip) == net.IPv6len && !ip.IsUnspecified() {
+			return true
+		}
+	}
+	return false
+}
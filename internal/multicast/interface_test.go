@@ -7,7 +7,7 @@ import (
 )
 
 func TestInterfaces(t *testing.T) {
-	list, err := interfaces()
+	list, err := interfaces(IPv4, nil)
 	if err != nil {
 		t.Fatalf("interfaces() failed: %s", err)
 	}
@@ -16,6 +16,18 @@ func TestInterfaces(t *testing.T) {
 	}
 }
 
+func TestInterfacesIPv6(t *testing.T) {
+	list, err := interfaces(IPv6, nil)
+	if err != nil {
+		t.Fatalf("interfaces() failed: %s", err)
+	}
+	for _, ifi := range list {
+		if !hasIPv6Address(&ifi) {
+			t.Errorf("interface %s has no IPv6 addresses", ifi.Name)
+		}
+	}
+}
+
 func TestInterafceProviders(t *testing.T) {
 	want := []net.Interface{
 		{Index: 123, Name: "Test#1"},
@@ -26,7 +38,7 @@ func TestInterafceProviders(t *testing.T) {
 		return want
 	}
 	defer func() { InterfacesProvider = nil }()
-	got, err := interfaces()
+	got, err := interfaces(IPv4, nil)
 	if err != nil {
 		t.Fatalf("interfaces() failed: %s", err)
 	}
@@ -2,75 +2,191 @@ package multicast
 
 import (
 	"errors"
+	"fmt"
 	"io"
 	"net"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/koron/go-ssdp/internal/ssdplog"
-	"golang.org/x/net/ipv4"
 )
 
 // Conn is multicast connection.
 type Conn struct {
 	laddr *net.UDPAddr
-	pconn *ipv4.PacketConn
+	log   *ssdplog.Logger
 
-	// ifps stores pointers of multicast interface.
+	// socks stores sockets for each address family.
+	socks []*socket
+}
+
+// socket is a multicast socket for an address family.
+type socket struct {
+	family Family
+	laddr  *net.UDPAddr
+	port   int
+	pconn  packetConn
+
+	// groups stores multicast group addresses to send.
+	groups []*net.UDPAddr
+
+	// sysIf indicates the system assigned multicast interface is used.
+	sysIf bool
+
+	// ifis is interfaces to multicast, which are given by ConnInterfaces.
+	ifis []net.Interface
+
+	log *ssdplog.Logger
+
+	// ifps stores pointers of multicast interface.  It is updated by
+	// UpdateInterfaces, so it should be accessed via interfaceList().
 	ifps []*net.Interface
+	imu  sync.Mutex
+
+	// addrs stores unicast addresses of the family for each interface in
+	// ifps, to detect changes of them.  It is used by updateInterfaces only.
+	addrs map[int][]string
+
+	// wmu serializes writes, because a multicast interface is a state of
+	// the socket.
+	wmu sync.Mutex
 }
 
 type connConfig struct {
-	ttl   int
-	sysIf bool
+	ttl      int
+	sysIf    bool
+	family   Family
+	groups6  []net.IP
+	ifis     []net.Interface
+	sendAddr string
+	port     int
+	log      *ssdplog.Logger
 }
 
 // Listen starts to receiving multicast messages.
+// IPv4 is used when no families are specified by ConnFamily().
+// On DualStack, a family which failed to listen is skipped.
 func Listen(r *AddrResolver, opts ...ConnOption) (*Conn, error) {
-	// prepare parameters.
-	laddr, err := r.resolve()
-	if err != nil {
-		return nil, err
-	}
 	// configure connection
 	var cfg connConfig
 	for _, o := range opts {
 		o.apply(&cfg)
 	}
+	family := cfg.family
+	if family == 0 {
+		family = IPv4
+	}
+	if SystemAssignedInterface {
+		cfg.sysIf = true
+	}
+	mc := &Conn{log: cfg.log}
+	var lastErr error
+	for _, f := range []Family{IPv4, IPv6} {
+		if !family.Has(f) {
+			continue
+		}
+		sock, err := listenSocket(r, f, &cfg)
+		if err != nil {
+			if family == DualStack {
+				cfg.log.Warn("failed to listen", ssdplog.KeyEvent, "listen", "network", f.network(), ssdplog.KeyError, err)
+				lastErr = err
+				continue
+			}
+			mc.Close()
+			return nil, err
+		}
+		mc.socks = append(mc.socks, sock)
+	}
+	if len(mc.socks) == 0 {
+		return nil, lastErr
+	}
+	mc.laddr = mc.socks[0].laddr
+	return mc, nil
+}
+
+// listenSocket starts to receiving multicast messages for a family.
+func listenSocket(r *AddrResolver, f Family, cfg *connConfig) (*socket, error) {
+	// prepare parameters.
+	laddr, err := r.resolveFamily(f)
+	if err != nil {
+		return nil, err
+	}
+	groups, err := cfg.sendAddrs(f)
+	if err != nil {
+		return nil, err
+	}
 	// connect.
-	conn, err := net.ListenUDP("udp4", laddr)
+	conn, err := net.ListenUDP(f.network(), laddr)
 	if err != nil {
 		return nil, err
 	}
 	// configure socket to use with multicast.
-	pconn, ifplist, err := newIPv4MulticastConn(conn, cfg.sysIf)
+	pconn, ifplist, err := newMulticastConn(conn, f, cfg, groups)
 	if err != nil {
 		conn.Close()
 		return nil, err
 	}
-	// set TTL
+	// set TTL for multicast packets
 	if cfg.ttl > 0 {
-		err := pconn.SetTTL(cfg.ttl)
+		err := pconn.setMulticastTTL(cfg.ttl)
 		if err != nil {
 			pconn.Close()
 			return nil, err
 		}
 	}
-	return &Conn{
-		laddr: laddr,
-		pconn: pconn,
-		ifps:  ifplist,
+	var port int
+	if a, ok := conn.LocalAddr().(*net.UDPAddr); ok {
+		port = a.Port
+	}
+	return &socket{
+		family: f,
+		laddr:  laddr,
+		port:   port,
+		sysIf:  cfg.sysIf,
+		ifis:   cfg.ifis,
+		log:    cfg.log,
+		pconn:  pconn,
+		groups: groups,
+		ifps:   ifplist,
+		addrs:  addrsMap(ifplist, f),
 	}, nil
 }
 
-// newIPv4MulticastConn create a new multicast connection.
-// 2nd return parameter will be nil when sysIf is true.
-func newIPv4MulticastConn(conn *net.UDPConn, sysIf bool) (*ipv4.PacketConn, []*net.Interface, error) {
+// sendAddrs returns addresses to send multicast packets for a family.
+func (cfg *connConfig) sendAddrs(f Family) ([]*net.UDPAddr, error) {
+	var groups []*net.UDPAddr
+	if f == IPv6 {
+		groups = SendAddrsIPv6(cfg.groups6)
+	} else {
+		var addr *net.UDPAddr
+		var err error
+		if cfg.sendAddr != "" {
+			addr, err = net.ResolveUDPAddr("udp4", cfg.sendAddr)
+		} else {
+			addr, err = SendAddr()
+		}
+		if err != nil {
+			return nil, err
+		}
+		groups = []*net.UDPAddr{addr}
+	}
+	if cfg.port > 0 {
+		for i, g := range groups {
+			groups[i] = &net.UDPAddr{IP: g.IP, Port: cfg.port, Zone: g.Zone}
+		}
+	}
+	return groups, nil
+}
+
+// newMulticastConn create a new multicast connection.
+// 2nd return parameter will be nil when cfg.sysIf is true.
+func newMulticastConn(conn *net.UDPConn, f Family, cfg *connConfig, groups []*net.UDPAddr) (packetConn, []*net.Interface, error) {
 	// sysIf: use system assigned multicast interface.
 	// the empty iflist indicate it.
 	var ifplist []*net.Interface
-	if !sysIf {
-		list, err := interfaces()
+	if !cfg.sysIf {
+		list, err := interfaces(f, cfg.ifis)
 		if err != nil {
 			return nil, nil, err
 		}
@@ -79,42 +195,51 @@ func newIPv4MulticastConn(conn *net.UDPConn, sysIf bool) (*ipv4.PacketConn, []*n
 			ifplist = append(ifplist, &list[i])
 		}
 	}
-	addr, err := SendAddr()
-	if err != nil {
-		return nil, nil, err
-	}
-	pconn, err := joinGroupIPv4(conn, ifplist, addr)
+	pconn, err := joinGroup(newPacketConn(conn, f), ifplist, groups, cfg.log)
 	if err != nil {
 		return nil, nil, err
 	}
 	return pconn, ifplist, nil
 }
 
-// joinGroupIPv4 makes the connection join to a group on interfaces.
+// joinGroup makes the connection join to groups on interfaces.
 // This trys to use system assigned when iflist is nil or empty.
-func joinGroupIPv4(conn *net.UDPConn, ifplist []*net.Interface, gaddr net.Addr) (*ipv4.PacketConn, error) {
-	wrap := ipv4.NewPacketConn(conn)
+func joinGroup(wrap packetConn, ifplist []*net.Interface, groups []*net.UDPAddr, log *ssdplog.Logger) (packetConn, error) {
 	wrap.SetMulticastLoopback(true)
+	// receiving interfaces are informational, so ignore errors on platforms
+	// which don't support it.
+	if err := wrap.setControlMessage(); err != nil {
+		log.Warn("failed to enable control messages", ssdplog.KeyEvent, "listen", ssdplog.KeyError, err)
+	}
 
 	// try to use the system assigned multicast interface when iflist is empty.
 	if len(ifplist) == 0 {
-		if err := wrap.JoinGroup(nil, gaddr); err != nil {
-			ssdplog.Printf("failed to join group %s on system assigned multicast interface: %s", gaddr.String(), err)
+		joined := 0
+		for _, gaddr := range groups {
+			if err := wrap.JoinGroup(nil, gaddr); err != nil {
+				log.Warn("failed to join group", ssdplog.KeyEvent, "join", "group", gaddr.String(), ssdplog.KeyInterface, "system", ssdplog.KeyError, err)
+				continue
+			}
+			joined++
+			log.Debug("joined group", ssdplog.KeyEvent, "join", "group", gaddr.String(), ssdplog.KeyInterface, "system")
+		}
+		if joined == 0 {
 			return nil, errors.New("no system assigned multicast interfaces had joined to group")
 		}
-		ssdplog.Printf("joined group %s on system assigned multicast interface", gaddr.String())
 		return wrap, nil
 	}
 
 	// add interfaces to multicast group.
 	joined := 0
 	for _, ifi := range ifplist {
-		if err := wrap.JoinGroup(ifi, gaddr); err != nil {
-			ssdplog.Printf("failed to join group %s on %s: %s", gaddr.String(), ifi.Name, err)
-			continue
+		for _, gaddr := range groups {
+			if err := wrap.JoinGroup(ifi, gaddr); err != nil {
+				log.Warn("failed to join group", ssdplog.KeyEvent, "join", "group", gaddr.String(), ssdplog.KeyInterface, ifi.Name, ssdplog.KeyError, err)
+				continue
+			}
+			joined++
+			log.Debug("joined group", ssdplog.KeyEvent, "join", "group", gaddr.String(), ssdplog.KeyInterface, ifi.Name)
 		}
-		joined++
-		ssdplog.Printf("joined group %s on %s (#%d)", gaddr.String(), ifi.Name, ifi.Index)
 	}
 	if joined == 0 {
 		return nil, errors.New("no interfaces had joined to group")
@@ -124,8 +249,14 @@ func joinGroupIPv4(conn *net.UDPConn, ifplist []*net.Interface, gaddr net.Addr)
 
 // Close closes a multicast connection.
 func (mc *Conn) Close() error {
-	// based net.UDPConn will be closed by mc.pconn.Close()
-	return mc.pconn.Close()
+	var firstErr error
+	for _, s := range mc.socks {
+		// based net.UDPConn will be closed by s.pconn.Close()
+		if err := s.pconn.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
 }
 
 // DataProvider provides a body of multicast message to send.
@@ -139,19 +270,61 @@ func (b BytesDataProvider) Bytes(ifi *net.Interface) []byte {
 	return []byte(b)
 }
 
+// DataProviderFunc is an adapter to use a function as DataProvider.
+type DataProviderFunc func(*net.Interface) []byte
+
+func (f DataProviderFunc) Bytes(ifi *net.Interface) []byte {
+	return f(ifi)
+}
+
+// Groups returns multicast group addresses to send for all families.
+func (mc *Conn) Groups() []*net.UDPAddr {
+	var groups []*net.UDPAddr
+	for _, s := range mc.socks {
+		groups = append(groups, s.groups...)
+	}
+	return groups
+}
+
+// Group returns a multicast group address to send for the family of "to"
+// address.  This returns nil when no sockets for the family.
+func (mc *Conn) Group(to net.Addr) *net.UDPAddr {
+	s := mc.socketFor(to)
+	if s == nil || len(s.groups) == 0 {
+		return nil
+	}
+	return s.groups[0]
+}
+
+// socketFor returns a socket for the family of "to" address.
+func (mc *Conn) socketFor(to net.Addr) *socket {
+	f := familyOf(to)
+	for _, s := range mc.socks {
+		if s.family == f {
+			return s
+		}
+	}
+	return nil
+}
+
 // WriteTo sends a multicast message to interfaces.
 func (mc *Conn) WriteTo(dataProv DataProvider, to net.Addr) (int, error) {
+	s := mc.socketFor(to)
+	if s == nil {
+		return 0, fmt.Errorf("no sockets to write to %s", to.String())
+	}
 	// Send a multicast message directory when recipient "to" address is not multicast.
-	if uaddr, ok := to.(*net.UDPAddr); !ok || !uaddr.IP.IsMulticast() || len(mc.ifps) == 0 {
-		return mc.writeToIfi(dataProv, to, nil)
+	ifps := s.interfaceList()
+	if uaddr, ok := to.(*net.UDPAddr); !ok || !uaddr.IP.IsMulticast() || len(ifps) == 0 {
+		return s.writeToIfi(dataProv, to, nil)
 	}
 	// Send a multicast message to all interfaces (iflist).
 	sum := 0
 	var lastErr error
-	for _, ifi := range mc.ifps {
-		n, err := mc.writeToIfi(dataProv, to, ifi)
+	for _, ifi := range ifps {
+		n, err := s.writeToIfi(dataProv, to, ifi)
 		if err != nil {
-			ssdplog.Printf("failed to write to %s: %s", ifi.Name, err)
+			s.log.Warn("failed to write", ssdplog.KeyEvent, "write", "to", to.String(), ssdplog.KeyInterface, ifi.Name, ssdplog.KeyError, err)
 			lastErr = err
 			continue
 		}
@@ -163,13 +336,40 @@ func (mc *Conn) WriteTo(dataProv DataProvider, to net.Addr) (int, error) {
 	return sum, nil
 }
 
-func (mc *Conn) writeToIfi(dataProv DataProvider, to net.Addr, ifi *net.Interface) (int, error) {
+// interfaceList returns a snapshot of interfaces to multicast.
+func (s *socket) interfaceList() []*net.Interface {
+	s.imu.Lock()
+	defer s.imu.Unlock()
+	return s.ifps
+}
+
+func (s *socket) writeToIfi(dataProv DataProvider, to net.Addr, ifi *net.Interface) (int, error) {
+	s.wmu.Lock()
+	defer s.wmu.Unlock()
 	if ifi != nil {
-		if err := mc.pconn.SetMulticastInterface(ifi); err != nil {
+		if err := s.pconn.SetMulticastInterface(ifi); err != nil {
 			return 0, err
 		}
 	}
-	return mc.pconn.WriteTo(dataProv.Bytes(ifi), nil, to)
+	return s.pconn.writeTo(dataProv.Bytes(ifi), to, 0)
+}
+
+// WriteToIfi sends a message to an address through an interface.
+// The interface is chosen by the system when ifi is nil.
+func (mc *Conn) WriteToIfi(dataProv DataProvider, to net.Addr, ifi *net.Interface) (int, error) {
+	if ifi == nil {
+		return mc.WriteTo(dataProv, to)
+	}
+	s := mc.socketFor(to)
+	if s == nil {
+		return 0, fmt.Errorf("no sockets to write to %s", to.String())
+	}
+	if uaddr, ok := to.(*net.UDPAddr); ok && uaddr.IP.IsMulticast() {
+		return s.writeToIfi(dataProv, to, ifi)
+	}
+	s.wmu.Lock()
+	defer s.wmu.Unlock()
+	return s.pconn.writeTo(dataProv.Bytes(ifi), to, ifi.Index)
 }
 
 // LocalAddr returns local address to listen multicast packets.
@@ -178,13 +378,58 @@ func (mc *Conn) LocalAddr() net.Addr {
 }
 
 // ReadPackets reads multicast packets.
+// The handler is never called concurrently, even if packets are received by
+// multiple sockets for DualStack.
 func (mc *Conn) ReadPackets(timeout time.Duration, h PacketHandler) error {
-	buf := make([]byte, 65535)
+	if len(mc.socks) == 1 {
+		return mc.socks[0].readPackets(timeout, h)
+	}
+	var mu sync.Mutex
+	hh := func(addr net.Addr, data []byte, info PacketInfo) error {
+		mu.Lock()
+		defer mu.Unlock()
+		return h(addr, data, info)
+	}
+	errs := make(chan error, len(mc.socks))
+	for _, s := range mc.socks {
+		go func() {
+			errs <- s.readPackets(timeout, hh)
+		}()
+	}
+	var firstErr error
+	for range mc.socks {
+		if err := <-errs; err != nil && firstErr == nil {
+			firstErr = err
+			// interrupt readers for other sockets.
+			for _, s := range mc.socks {
+				s.pconn.SetReadDeadline(time.Now())
+			}
+		}
+	}
+	return firstErr
+}
+
+// maxPacketSize is a size of buffers to read packets.
+const maxPacketSize = 65535
+
+// bufPool pools buffers to read packets, because ReadPackets is called for
+// each search.
+var bufPool = sync.Pool{
+	New: func() any {
+		b := make([]byte, maxPacketSize)
+		return &b
+	},
+}
+
+func (s *socket) readPackets(timeout time.Duration, h PacketHandler) error {
+	bp := bufPool.Get().(*[]byte)
+	defer bufPool.Put(bp)
+	buf := *bp
 	if timeout > 0 {
-		mc.pconn.SetReadDeadline(time.Now().Add(timeout))
+		s.pconn.SetReadDeadline(time.Now().Add(timeout))
 	}
 	for {
-		n, _, addr, err := mc.pconn.ReadFrom(buf)
+		n, info, addr, err := s.pconn.readFrom(buf)
 		if err != nil {
 			if nerr, ok := err.(net.Error); ok && nerr.Timeout() {
 				return nil
@@ -194,7 +439,10 @@ func (mc *Conn) ReadPackets(timeout time.Duration, h PacketHandler) error {
 			}
 			return err
 		}
-		if err := h(addr, buf[:n]); err != nil {
+		if info.Dst != nil {
+			info.Dst.Port = s.port
+		}
+		if err := h(addr, buf[:n], info); err != nil {
 			return err
 		}
 	}
@@ -211,7 +459,8 @@ func (f connOptFunc) apply(cfg *connConfig) {
 	f(cfg)
 }
 
-// ConnTTL returns as ConnOption that set default TTL to the connection.
+// ConnTTL returns as ConnOption that set TTL (hop limit for IPv6) of
+// multicast packets to the connection.
 func ConnTTL(ttl int) ConnOption {
 	return connOptFunc(func(cfg *connConfig) {
 		cfg.ttl = ttl
@@ -223,3 +472,48 @@ func ConnSystemAssginedInterface() ConnOption {
 		cfg.sysIf = true
 	})
 }
+
+// ConnFamily returns as ConnOption that set address families to listen.
+func ConnFamily(f Family) ConnOption {
+	return connOptFunc(func(cfg *connConfig) {
+		cfg.family = f
+	})
+}
+
+// ConnGroupsIPv6 returns as ConnOption that set multicast groups (scopes) to
+// join and send on IPv6.
+func ConnGroupsIPv6(groups []net.IP) ConnOption {
+	return connOptFunc(func(cfg *connConfig) {
+		cfg.groups6 = groups
+	})
+}
+
+// ConnInterfaces returns as ConnOption that set interfaces to multicast.
+// InterfacesProvider is used when ifis is empty.
+func ConnInterfaces(ifis []net.Interface) ConnOption {
+	return connOptFunc(func(cfg *connConfig) {
+		cfg.ifis = ifis
+	})
+}
+
+// ConnSendAddrIPv4 returns as ConnOption that set an address to send
+// multicast packets on IPv4.
+func ConnSendAddrIPv4(addr string) ConnOption {
+	return connOptFunc(func(cfg *connConfig) {
+		cfg.sendAddr = addr
+	})
+}
+
+// ConnPort returns as ConnOption that set a port to send multicast packets.
+func ConnPort(port int) ConnOption {
+	return connOptFunc(func(cfg *connConfig) {
+		cfg.port = port
+	})
+}
+
+// ConnLogger returns as ConnOption that set a logger.
+func ConnLogger(log *ssdplog.Logger) ConnOption {
+	return connOptFunc(func(cfg *connConfig) {
+		cfg.log = log
+	})
+}
@@ -2,17 +2,39 @@ package multicast
 
 import (
 	"net"
+	"strconv"
+	"strings"
 	"sync"
 )
 
-type PacketHandler func(net.Addr, []byte) error
+// PacketHandler handles a received packet.  The data is valid only until
+// the handler returns, because the buffer is reused.
+type PacketHandler func(net.Addr, []byte, PacketInfo) error
+
+// PacketInfo holds information of a received packet.
+type PacketInfo struct {
+	// IfIndex is an index of the interface which received the packet.
+	// It is 0 when unknown.
+	IfIndex int
+
+	// Dst is a destination address of the packet, it may be a multicast
+	// group address.  Its port is a local port of the receiving socket.
+	// It is nil when unknown.
+	Dst *net.UDPAddr
+}
 
 type AddrResolver struct {
 	Addr string
 
-	mu  sync.Mutex
-	udp *net.UDPAddr
-	err error
+	// AddrIPv6 is an address for IPv6. Addr is used for IPv6 too when this
+	// is empty.
+	AddrIPv6 string
+
+	mu   sync.Mutex
+	udp  *net.UDPAddr
+	err  error
+	udp6 *net.UDPAddr
+	err6 error
 }
 
 func (r *AddrResolver) setAddress(addr string) {
@@ -38,7 +60,66 @@ func (r *AddrResolver) resolve() (*net.UDPAddr, error) {
 	return r.udp, r.err
 }
 
-var RecvAddrResolver = &AddrResolver{Addr: "224.0.0.1:1900"}
+func (r *AddrResolver) resolveIPv6() (*net.UDPAddr, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if err := r.err6; err != nil {
+		return nil, err
+	}
+	if udp := r.udp6; udp != nil {
+		return udp, nil
+	}
+
+	addr := r.AddrIPv6
+	if addr == "" {
+		addr = r.Addr
+	}
+	r.udp6, r.err6 = net.ResolveUDPAddr("udp6", addr)
+	return r.udp6, r.err6
+}
+
+// resolveFamily resolves an address for the family f.
+func (r *AddrResolver) resolveFamily(f Family) (*net.UDPAddr, error) {
+	if f == IPv6 {
+		return r.resolveIPv6()
+	}
+	return r.resolve()
+}
+
+var RecvAddrResolver = &AddrResolver{
+	Addr:     "224.0.0.1:1900",
+	AddrIPv6: "[ff02::c]:1900",
+}
+
+// NewRecvAddrResolver creates an AddrResolver to receive multicast packets
+// based on RecvAddrResolver.  addr overrides an address for IPv4 when it is
+// not empty, and port overrides ports when it is positive.
+func NewRecvAddrResolver(addr string, port int) *AddrResolver {
+	RecvAddrResolver.mu.Lock()
+	r := &AddrResolver{
+		Addr:     RecvAddrResolver.Addr,
+		AddrIPv6: RecvAddrResolver.AddrIPv6,
+	}
+	RecvAddrResolver.mu.Unlock()
+	if addr != "" {
+		r.Addr = addr
+	}
+	if port > 0 {
+		r.Addr = replacePort(r.Addr, port)
+		r.AddrIPv6 = replacePort(r.AddrIPv6, port)
+	}
+	return r
+}
+
+// replacePort replaces a port of the address.
+func replacePort(addr string, port int) string {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		host = strings.Trim(addr, "[]")
+	}
+	return net.JoinHostPort(host, strconv.Itoa(port))
+}
 
 // SetRecvAddrIPv4 updates multicast address where to receive packets.
 // This never fail now.
@@ -60,3 +141,22 @@ func SetSendAddrIPv4(addr string) error {
 	sendAddrResolver.setAddress(addr)
 	return nil
 }
+
+// ipv6LinkLocal is a multicast address for SSDP in IPv6 link-local scope.
+var ipv6LinkLocal = net.ParseIP("ff02::c")
+
+// sendPortIPv6 is an UDP port to send multicast packets on IPv6.
+const sendPortIPv6 = 1900
+
+// SendAddrsIPv6 returns addresses to send multicast UDP packets on IPv6 for
+// the groups.  Link-local scope is used when groups is empty.
+func SendAddrsIPv6(groups []net.IP) []*net.UDPAddr {
+	if len(groups) == 0 {
+		groups = []net.IP{ipv6LinkLocal}
+	}
+	addrs := make([]*net.UDPAddr, 0, len(groups))
+	for _, ip := range groups {
+		addrs = append(addrs, &net.UDPAddr{IP: ip, Port: sendPortIPv6})
+	}
+	return addrs
+}
@@ -46,3 +46,39 @@ func TestSetMulticastSendAddrIPv4(t *testing.T) {
 		t.Errorf("cache mismatch: first=%p second=%p", first, second)
 	}
 }
+
+func TestNewRecvAddrResolver(t *testing.T) {
+	for i, tc := range []struct {
+		addr        string
+		port        int
+		want, want6 string
+	}{
+		{"", 0, RecvAddrResolver.Addr, RecvAddrResolver.AddrIPv6},
+		{"224.0.0.2:1900", 0, "224.0.0.2:1900", RecvAddrResolver.AddrIPv6},
+		{"", 19000, "224.0.0.1:19000", "[ff02::c]:19000"},
+		{"224.0.0.2:1900", 19000, "224.0.0.2:19000", "[ff02::c]:19000"},
+	} {
+		r := NewRecvAddrResolver(tc.addr, tc.port)
+		if r.Addr != tc.want || r.AddrIPv6 != tc.want6 {
+			t.Errorf("#%d unexpected addresses: want=%q,%q got=%q,%q", i, tc.want, tc.want6, r.Addr, r.AddrIPv6)
+		}
+	}
+}
+
+func TestConnConfigSendAddrs(t *testing.T) {
+	cfg := &connConfig{sendAddr: "239.255.255.251:1901", port: 19000}
+	groups, err := cfg.sendAddrs(IPv4)
+	if err != nil {
+		t.Fatalf("failed to get send addresses: %s", err)
+	}
+	if len(groups) != 1 || groups[0].String() != "239.255.255.251:19000" {
+		t.Errorf("unexpected IPv4 groups: %v", groups)
+	}
+	groups, err = cfg.sendAddrs(IPv6)
+	if err != nil {
+		t.Fatalf("failed to get send addresses: %s", err)
+	}
+	if len(groups) != 1 || groups[0].String() != "[ff02::c]:19000" {
+		t.Errorf("unexpected IPv6 groups: %v", groups)
+	}
+}
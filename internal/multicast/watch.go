@@ -0,0 +1,135 @@
+package multicast
+
+import (
+	"net"
+	"slices"
+
+	"github.com/koron/go-ssdp/internal/ssdplog"
+)
+
+// Joined is an interface which joined to multicast groups newly.
+type Joined struct {
+	Interface *net.Interface
+
+	// Groups is multicast group addresses to send via the interface.
+	Groups []*net.UDPAddr
+}
+
+// UpdateInterfaces updates interfaces to listen and to multicast, with
+// current network interfaces.  Groups are left on interfaces which
+// disappeared, and joined on interfaces which appeared or changed.  Changes
+// of unicast addresses are treated as changes of interfaces, because some
+// systems join groups by addresses of interfaces.
+// This returns interfaces which joined newly.
+// Sockets which use the system assigned multicast interface are not
+// updated.
+func (mc *Conn) UpdateInterfaces() ([]Joined, error) {
+	var joined []Joined
+	for _, s := range mc.socks {
+		ifps, err := s.updateInterfaces()
+		if err != nil {
+			return joined, err
+		}
+		for _, ifi := range ifps {
+			joined = append(joined, Joined{Interface: ifi, Groups: s.groups})
+		}
+	}
+	return joined, nil
+}
+
+func (s *socket) updateInterfaces() ([]*net.Interface, error) {
+	if s.sysIf {
+		return nil, nil
+	}
+	list, err := interfaces(s.family, s.ifis)
+	if err != nil {
+		return nil, err
+	}
+	curr := s.interfaceList()
+	next := make([]*net.Interface, 0, len(list))
+	nextAddrs := make(map[int][]string, len(list))
+	var joined []*net.Interface
+
+	// leave groups on interfaces which disappeared or changed.
+	for _, old := range curr {
+		i := slices.IndexFunc(list, func(ifi net.Interface) bool {
+			return ifi.Index == old.Index
+		})
+		if i >= 0 && sameInterface(old, &list[i]) {
+			if addrs := familyAddrs(&list[i], s.family); slices.Equal(addrs, s.addrs[old.Index]) {
+				next = append(next, old)
+				nextAddrs[old.Index] = addrs
+				continue
+			}
+		}
+		for _, gaddr := range s.groups {
+			// errors are ignored, because the interface may be gone.
+			s.pconn.LeaveGroup(old, gaddr)
+		}
+		s.log.Info("left groups", ssdplog.KeyEvent, "leave", ssdplog.KeyInterface, old.Name)
+	}
+
+	// join groups on interfaces which appeared or changed.
+	for i := range list {
+		ifi := &list[i]
+		if slices.ContainsFunc(next, func(v *net.Interface) bool {
+			return v.Index == ifi.Index
+		}) {
+			continue
+		}
+		n := 0
+		for _, gaddr := range s.groups {
+			if err := s.pconn.JoinGroup(ifi, gaddr); err != nil {
+				s.log.Warn("failed to join group", ssdplog.KeyEvent, "join", "group", gaddr.String(), ssdplog.KeyInterface, ifi.Name, ssdplog.KeyError, err)
+				continue
+			}
+			n++
+			s.log.Info("joined group", ssdplog.KeyEvent, "join", "group", gaddr.String(), ssdplog.KeyInterface, ifi.Name)
+		}
+		// retry to join on next update when failed.
+		if n == 0 {
+			continue
+		}
+		next = append(next, ifi)
+		nextAddrs[ifi.Index] = familyAddrs(ifi, s.family)
+		joined = append(joined, ifi)
+	}
+
+	s.imu.Lock()
+	s.ifps = next
+	s.imu.Unlock()
+	s.addrs = nextAddrs
+	return joined, nil
+}
+
+// sameInterface checks two interfaces are same or not, except addresses.
+func sameInterface(a, b *net.Interface) bool {
+	return a.Index == b.Index && a.Name == b.Name && a.Flags == b.Flags
+}
+
+// familyAddrs returns sorted unicast addresses of ifi for the family.
+func familyAddrs(ifi *net.Interface, f Family) []string {
+	addrs, err := interfaceAddrs(ifi)
+	if err != nil {
+		return nil
+	}
+	var list []string
+	for _, a := range addrs {
+		ip, _, err := net.ParseCIDR(a.String())
+		if err != nil || (ip.To4() != nil) != (f == IPv4) {
+			continue
+		}
+		list = append(list, a.String())
+	}
+	slices.Sort(list)
+	return list
+}
+
+// addrsMap returns unicast addresses of the family for each interface.
+func addrsMap(ifps []*net.Interface, f Family) map[int][]string {
+	m := make(map[int][]string, len(ifps))
+	for _, ifi := range ifps {
+		m[ifi.Index] = familyAddrs(ifi, f)
+	}
+	return m
+}
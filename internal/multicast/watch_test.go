@@ -0,0 +1,123 @@
+package multicast
+
+import (
+	"net"
+	"testing"
+)
+
+func TestUpdateInterfaces(t *testing.T) {
+	lo, err := net.InterfaceByName("lo")
+	if err != nil {
+		t.Skipf("no loopback interfaces: %s", err)
+	}
+	base, err := interfaces(IPv4, nil)
+	if err != nil || len(base) == 0 {
+		t.Skipf("no interfaces: %s", err)
+	}
+	var list []net.Interface
+	InterfacesProvider = func() []net.Interface {
+		return list
+	}
+	defer func() { InterfacesProvider = nil }()
+
+	list = append(base, *lo)
+	mc, err := Listen(&AddrResolver{})
+	if err != nil {
+		t.Fatalf("failed to listen: %s", err)
+	}
+	defer mc.Close()
+	if n := len(mc.socks[0].interfaceList()); n != len(list) {
+		t.Fatalf("unexpected number of interfaces: want=%d got=%d", len(list), n)
+	}
+
+	// no changes.
+	joined, err := mc.UpdateInterfaces()
+	if err != nil {
+		t.Fatalf("failed to update interfaces: %s", err)
+	}
+	if len(joined) != 0 {
+		t.Errorf("unexpected joined interfaces: %+v", joined)
+	}
+
+	// remove the loopback.
+	list = base
+	joined, err = mc.UpdateInterfaces()
+	if err != nil {
+		t.Fatalf("failed to update interfaces: %s", err)
+	}
+	if len(joined) != 0 {
+		t.Errorf("unexpected joined interfaces: %+v", joined)
+	}
+	for _, ifi := range mc.socks[0].interfaceList() {
+		if ifi.Index == lo.Index {
+			t.Errorf("loopback should be removed")
+		}
+	}
+
+	// add the loopback again.
+	list = append(base, *lo)
+	joined, err = mc.UpdateInterfaces()
+	if err != nil {
+		t.Fatalf("failed to update interfaces: %s", err)
+	}
+	if len(joined) != 1 || joined[0].Interface.Index != lo.Index {
+		t.Fatalf("loopback should be joined: %+v", joined)
+	}
+	if len(joined[0].Groups) == 0 {
+		t.Error("no groups for joined interface")
+	}
+	if n := len(mc.socks[0].interfaceList()); n != len(list) {
+		t.Errorf("unexpected number of interfaces: want=%d got=%d", len(list), n)
+	}
+}
+
+func TestUpdateInterfaces_AddrChanged(t *testing.T) {
+	lo, err := net.InterfaceByName("lo")
+	if err != nil {
+		t.Skipf("no loopback interfaces: %s", err)
+	}
+	InterfacesProvider = func() []net.Interface {
+		return []net.Interface{*lo}
+	}
+	defer func() { InterfacesProvider = nil }()
+	addr := "127.0.0.1/8"
+	interfaceAddrs = func(*net.Interface) ([]net.Addr, error) {
+		ip, ipnet, err := net.ParseCIDR(addr)
+		if err != nil {
+			return nil, err
+		}
+		ipnet.IP = ip
+		return []net.Addr{ipnet}, nil
+	}
+	defer func() { interfaceAddrs = (*net.Interface).Addrs }()
+
+	mc, err := Listen(&AddrResolver{})
+	if err != nil {
+		t.Fatalf("failed to listen: %s", err)
+	}
+	defer mc.Close()
+
+	for i, tc := range []struct {
+		addr   string
+		joined int
+	}{
+		{"127.0.0.1/8", 0},
+		{"127.0.0.2/8", 1},
+		{"127.0.0.2/8", 0},
+	} {
+		addr = tc.addr
+		joined, err := mc.UpdateInterfaces()
+		if err != nil {
+			t.Fatalf("#%d failed to update interfaces: %s", i, err)
+		}
+		if len(joined) != tc.joined {
+			t.Errorf("#%d unexpected joined interfaces: want=%d got=%+v", i, tc.joined, joined)
+			continue
+		}
+		for _, j := range joined {
+			if j.Interface.Index != lo.Index {
+				t.Errorf("#%d unexpected joined interface: %+v", i, j.Interface)
+			}
+		}
+	}
+}
@@ -3,7 +3,14 @@ Package ssdplog provides log mechanism for ssdp.
 */
 package ssdplog
 
-import "log"
+import (
+	"context"
+	"fmt"
+	"log"
+	"log/slog"
+	"strconv"
+	"strings"
+)
 
 var LoggerProvider = func() *log.Logger { return nil }
 
@@ -14,3 +21,152 @@ func Printf(s string, a ...any) {
 		}
 	}
 }
+
+// Keys of attributes for structured logs.
+const (
+	KeyEvent     = "event"
+	KeyST        = "st"
+	KeyUSN       = "usn"
+	KeyFrom      = "from"
+	KeyInterface = "interface"
+	KeyError     = "error"
+)
+
+// Logger is a logger for an instance, which logs structured messages.
+// A nil Logger logs with a logger which LoggerProvider provides.
+type Logger struct {
+	s *slog.Logger
+}
+
+// New creates a Logger which logs with l.  This returns nil when l is nil.
+func New(l *log.Logger) *Logger {
+	if l == nil {
+		return nil
+	}
+	return &Logger{s: slog.New(NewLegacyHandler(l))}
+}
+
+// NewSlog creates a Logger which logs with h.  This returns nil when h is
+// nil.
+func NewSlog(h slog.Handler) *Logger {
+	if h == nil {
+		return nil
+	}
+	return &Logger{s: slog.New(h)}
+}
+
+// Printf logs a formatted message at info level.
+func (lg *Logger) Printf(s string, a ...any) {
+	lg.Log(slog.LevelInfo, fmt.Sprintf(s, a...))
+}
+
+// Log logs a message with attributes at the level.  args are pairs of key
+// and value, or slog.Attr, same as slog.Logger.
+func (lg *Logger) Log(level slog.Level, msg string, args ...any) {
+	if lg != nil {
+		lg.s.Log(context.Background(), level, msg, args...)
+		return
+	}
+	p := LoggerProvider
+	if p == nil {
+		return
+	}
+	if l := p(); l != nil {
+		slog.New(NewLegacyHandler(l)).Log(context.Background(), level, msg, args...)
+	}
+}
+
+// Debug logs a message at debug level.
+func (lg *Logger) Debug(msg string, args ...any) {
+	lg.Log(slog.LevelDebug, msg, args...)
+}
+
+// Info logs a message at info level.
+func (lg *Logger) Info(msg string, args ...any) {
+	lg.Log(slog.LevelInfo, msg, args...)
+}
+
+// Warn logs a message at warn level.
+func (lg *Logger) Warn(msg string, args ...any) {
+	lg.Log(slog.LevelWarn, msg, args...)
+}
+
+// Error logs a message at error level.
+func (lg *Logger) Error(msg string, args ...any) {
+	lg.Log(slog.LevelError, msg, args...)
+}
+
+// legacyHandler is a slog.Handler which writes messages to log.Logger as
+// text, like "message key=value ...".  It writes messages at all levels.
+type legacyHandler struct {
+	l      *log.Logger
+	prefix string
+	attrs  []slog.Attr
+}
+
+// NewLegacyHandler creates a slog.Handler which writes messages to l as
+// text.  It writes messages at all levels, so it works like ssdp.Logger.
+func NewLegacyHandler(l *log.Logger) slog.Handler {
+	return &legacyHandler{l: l}
+}
+
+func (h *legacyHandler) Enabled(context.Context, slog.Level) bool {
+	return true
+}
+
+func (h *legacyHandler) Handle(_ context.Context, r slog.Record) error {
+	b := new(strings.Builder)
+	b.WriteString(r.Message)
+	for _, a := range h.attrs {
+		writeAttr(b, "", a)
+	}
+	r.Attrs(func(a slog.Attr) bool {
+		writeAttr(b, h.prefix, a)
+		return true
+	})
+	h.l.Print(b.String())
+	return nil
+}
+
+func (h *legacyHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	h2 := *h
+	h2.attrs = make([]slog.Attr, 0, len(h.attrs)+len(attrs))
+	h2.attrs = append(h2.attrs, h.attrs...)
+	for _, a := range attrs {
+		if h.prefix != "" {
+			a.Key = h.prefix + a.Key
+		}
+		h2.attrs = append(h2.attrs, a)
+	}
+	return &h2
+}
+
+func (h *legacyHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	h2 := *h
+	h2.prefix = h.prefix + name + "."
+	return &h2
+}
+
+func writeAttr(b *strings.Builder, prefix string, a slog.Attr) {
+	a.Value = a.Value.Resolve()
+	if a.Equal(slog.Attr{}) {
+		return
+	}
+	if a.Value.Kind() == slog.KindGroup {
+		if a.Key != "" {
+			prefix += a.Key + "."
+		}
+		for _, g := range a.Value.Group() {
+			writeAttr(b, prefix, g)
+		}
+		return
+	}
+	v := a.Value.String()
+	if v == "" || strings.ContainsAny(v, " \t\r\n\"=") {
+		v = strconv.Quote(v)
+	}
+	fmt.Fprintf(b, " %s%s=%s", prefix, a.Key, v)
+}
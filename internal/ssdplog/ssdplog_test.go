@@ -2,7 +2,10 @@ package ssdplog_test
 
 import (
 	"bytes"
+	"errors"
 	"log"
+	"log/slog"
+	"strings"
 	"testing"
 
 	"github.com/koron/go-ssdp/internal/ssdplog"
@@ -31,3 +34,46 @@ func TestLoggerProvider(t *testing.T) {
 		t.Errorf("unexpected log #1:\nwant=%q\n got=%q", "foo\n", s)
 	}
 }
+
+func TestLogger(t *testing.T) {
+	b0 := &bytes.Buffer{}
+	ssdplog.LoggerProvider = func() *log.Logger { return log.New(b0, "", 0) }
+	defer func() { ssdplog.LoggerProvider = func() *log.Logger { return nil } }()
+
+	b1 := &bytes.Buffer{}
+	ssdplog.New(log.New(b1, "", 0)).Printf("foo")
+	if s := b1.String(); s != "foo\n" {
+		t.Errorf("unexpected log:\nwant=%q\n got=%q", "foo\n", s)
+	}
+
+	// nil Logger logs with LoggerProvider.
+	ssdplog.New(nil).Printf("bar")
+	if s := b0.String(); s != "bar\n" {
+		t.Errorf("unexpected default log:\nwant=%q\n got=%q", "bar\n", s)
+	}
+}
+
+func TestLegacyHandler(t *testing.T) {
+	b := &bytes.Buffer{}
+	l := slog.New(ssdplog.NewLegacyHandler(log.New(b, "", 0)))
+	l.Debug("received", "st", "ssdp:all", "from", "192.0.2.1:1900")
+	l.With("event", "search").WithGroup("g").Warn("failed", "error", errors.New("bad thing"), "empty", "")
+	want := "received st=ssdp:all from=192.0.2.1:1900\n" +
+		"failed event=search g.error=\"bad thing\" g.empty=\"\"\n"
+	if s := b.String(); s != want {
+		t.Errorf("unexpected log:\nwant=%q\n got=%q", want, s)
+	}
+}
+
+func TestNewSlog(t *testing.T) {
+	if ssdplog.NewSlog(nil) != nil {
+		t.Error("NewSlog(nil) should return nil")
+	}
+	b := &bytes.Buffer{}
+	lg := ssdplog.NewSlog(slog.NewTextHandler(b, &slog.HandlerOptions{Level: slog.LevelWarn}))
+	lg.Debug("never output")
+	lg.Error("failed", ssdplog.KeyError, "bad")
+	if s := b.String(); !strings.Contains(s, "level=ERROR msg=failed error=bad") || strings.Contains(s, "never output") {
+		t.Errorf("unexpected log: %q", s)
+	}
+}
@@ -3,6 +3,9 @@ package ssdp
 import (
 	"fmt"
 	"net"
+	"net/url"
+	"strconv"
+	"strings"
 )
 
 // LocationProvider provides address for Location header which can be reached from
@@ -14,6 +17,18 @@ type LocationProvider interface {
 	Location(from net.Addr, ifi *net.Interface) string
 }
 
+// LocalLocationProvider is an optional interface of LocationProvider.
+// Advertiser calls LocalLocation instead of Location to respond M-SEARCH,
+// with a local address which received it.
+type LocalLocationProvider interface {
+	LocationProvider
+
+	// LocalLocation provides an address be reachable from "from" address.
+	// "local" is a local address which received a message from "from" on
+	// "ifi" interface.  "local" and "ifi" may be nil when unknown.
+	LocalLocation(from, local net.Addr, ifi *net.Interface) string
+}
+
 // LocationProviderFunc type is an adapter to allow the use of ordinary
 // functions are location providers.
 type LocationProviderFunc func(net.Addr, *net.Interface) string
@@ -38,3 +53,119 @@ func toLocationProvider(v any) (LocationProvider, error) {
 		return nil, fmt.Errorf("location should be a string or a ssdp.LocationProvider but got %T", w)
 	}
 }
+
+// transportLocationProvider is implemented by LocationProvider which
+// chooses an address from addresses of interfaces of the transport.
+type transportLocationProvider interface {
+	transportLocation(addrsOf func(*net.Interface) ([]net.Addr, error), from, local net.Addr, ifi *net.Interface) string
+}
+
+// location gets a location from the provider.  addrsOf returns addresses of
+// interfaces of the transport.  A zone of IPv6 link-local address is removed
+// from the location, because it is meaningless for other hosts.
+func location(p LocationProvider, addrsOf func(*net.Interface) ([]net.Addr, error), from net.Addr, ifi *net.Interface) string {
+	if tp, ok := p.(transportLocationProvider); ok {
+		return stripZone(tp.transportLocation(addrsOf, from, nil, ifi))
+	}
+	return stripZone(p.Location(from, ifi))
+}
+
+// searchLocation gets a location for a response to M-SEARCH which is
+// received from src.
+func searchLocation(p LocationProvider, addrsOf func(*net.Interface) ([]net.Addr, error), src Source) string {
+	if tp, ok := p.(transportLocationProvider); ok {
+		return stripZone(tp.transportLocation(addrsOf, src.From, src.LocalAddr, src.Interface))
+	}
+	if lp, ok := p.(LocalLocationProvider); ok {
+		return stripZone(lp.LocalLocation(src.From, src.LocalAddr, src.Interface))
+	}
+	return stripZone(p.Location(src.From, src.Interface))
+}
+
+// stripZone removes a zone of IPv6 address in host part of URL.
+func stripZone(s string) string {
+	u, err := url.Parse(s)
+	if err != nil || !strings.HasPrefix(u.Host, "[") {
+		return s
+	}
+	host, port, err := net.SplitHostPort(u.Host)
+	if err != nil {
+		host = strings.Trim(u.Host, "[]")
+	}
+	n := strings.IndexByte(host, '%')
+	if n < 0 {
+		return s
+	}
+	host = host[:n]
+	if port != "" {
+		u.Host = net.JoinHostPort(host, port)
+	} else {
+		u.Host = "[" + host + "]"
+	}
+	return u.String()
+}
+
+// zoneInterface returns an interface which is indicated by zone of IPv6
+// link-local address.  This returns nil when addr has no zones.
+func zoneInterface(addr net.Addr) *net.Interface {
+	uaddr, ok := addr.(*net.UDPAddr)
+	if !ok || uaddr.Zone == "" {
+		return nil
+	}
+	if n, err := strconv.Atoi(uaddr.Zone); err == nil {
+		ifi, err := net.InterfaceByIndex(n)
+		if err != nil {
+			return nil
+		}
+		return ifi
+	}
+	ifi, err := net.InterfaceByName(uaddr.Zone)
+	if err != nil {
+		return nil
+	}
+	return ifi
+}
+
+// localAddr returns a local address which received a message from src.
+// When the message is multicast, an address of the receiving interface in
+// the same network with the sender is chosen, from addresses which addrsOf
+// returns.  This returns nil when no addresses are found.
+func localAddr(src Source, addrsOf func(*net.Interface) ([]net.Addr, error)) net.Addr {
+	dst, ok := src.LocalAddr.(*net.UDPAddr)
+	if !ok {
+		return nil
+	}
+	if !dst.IP.IsMulticast() {
+		return dst
+	}
+	from, ok := src.From.(*net.UDPAddr)
+	if !ok || src.Interface == nil {
+		return nil
+	}
+	addrs, err := addrsOf(src.Interface)
+	if err != nil {
+		return nil
+	}
+	var found *net.IPNet
+	for _, a := range addrs {
+		ipnet, ok := a.(*net.IPNet)
+		if !ok || (ipnet.IP.To4() == nil) != (from.IP.To4() == nil) {
+			continue
+		}
+		if ipnet.Contains(from.IP) {
+			found = ipnet
+			break
+		}
+		if found == nil {
+			found = ipnet
+		}
+	}
+	if found == nil {
+		return nil
+	}
+	laddr := &net.UDPAddr{IP: found.IP, Port: dst.Port}
+	if found.IP.IsLinkLocalUnicast() && found.IP.To4() == nil {
+		laddr.Zone = src.Interface.Name
+	}
+	return laddr
+}
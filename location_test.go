@@ -0,0 +1,78 @@
+package ssdp
+
+import (
+	"net"
+	"testing"
+)
+
+func TestStripZone(t *testing.T) {
+	for i, tc := range []struct {
+		in, want string
+	}{
+		{"http://192.168.0.1:8080/desc.xml", "http://192.168.0.1:8080/desc.xml"},
+		{"http://[fe80::1]:8080/desc.xml", "http://[fe80::1]:8080/desc.xml"},
+		{"http://[fe80::1%25eth0]:8080/desc.xml", "http://[fe80::1]:8080/desc.xml"},
+		{"http://[fe80::1%25eth0]/desc.xml", "http://[fe80::1]/desc.xml"},
+		{"location:foo", "location:foo"},
+		{"", ""},
+	} {
+		if got := stripZone(tc.in); got != tc.want {
+			t.Errorf("#%d unexpected result for %q:\nwant=%q\n got=%q", i, tc.in, tc.want, got)
+		}
+	}
+}
+
+func TestLocalAddr(t *testing.T) {
+	ifi, ipnet := findIPv4Interface(t)
+	from := &net.UDPAddr{IP: ipnet.IP, Port: 12345}
+
+	// unicast destination is used as is.
+	dst := &net.UDPAddr{IP: ipnet.IP, Port: 1900}
+	if got := localAddr(Source{From: from, Interface: ifi, LocalAddr: dst}, (*net.Interface).Addrs); got != dst {
+		t.Errorf("unexpected local address for unicast: want=%s got=%s", dst, got)
+	}
+
+	// an address of the interface is chosen for multicast.
+	group := &net.UDPAddr{IP: net.IPv4(239, 255, 255, 250), Port: 1900}
+	got, ok := localAddr(Source{From: from, Interface: ifi, LocalAddr: group}, (*net.Interface).Addrs).(*net.UDPAddr)
+	if !ok {
+		t.Fatal("no local addresses for multicast")
+	}
+	if !got.IP.Equal(ipnet.IP) || got.Port != 1900 {
+		t.Errorf("unexpected local address for multicast: want=%s got=%s", ipnet.IP, got)
+	}
+
+	// nil when unknown.
+	if got := localAddr(Source{From: from, LocalAddr: group}, (*net.Interface).Addrs); got != nil {
+		t.Errorf("local address should be nil without interfaces: %s", got)
+	}
+	if got := localAddr(Source{From: from, Interface: ifi}, (*net.Interface).Addrs); got != nil {
+		t.Errorf("local address should be nil without destinations: %s", got)
+	}
+}
+
+// findIPv4Interface finds a multicast interface which has an IPv4 address.
+func findIPv4Interface(t *testing.T) (*net.Interface, *net.IPNet) {
+	t.Helper()
+	list, err := net.Interfaces()
+	if err != nil {
+		t.Fatalf("failed to get interfaces: %s", err)
+	}
+	for i := range list {
+		ifi := &list[i]
+		if ifi.Flags&net.FlagUp == 0 || ifi.Flags&net.FlagMulticast == 0 {
+			continue
+		}
+		addrs, err := ifi.Addrs()
+		if err != nil {
+			continue
+		}
+		for _, a := range addrs {
+			if ipnet, ok := a.(*net.IPNet); ok && ipnet.IP.To4() != nil {
+				return ifi, ipnet
+			}
+		}
+	}
+	t.Skip("no interfaces with IPv4 address")
+	return nil, nil
+}
@@ -0,0 +1,488 @@
+package ssdp
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/textproto"
+	"strconv"
+	"strings"
+)
+
+// Values of NTS header.
+const (
+	NTSAlive  = "ssdp:alive"
+	NTSByebye = "ssdp:byebye"
+	NTSUpdate = "ssdp:update"
+)
+
+// manDiscover is a value of MAN header for M-SEARCH.
+const manDiscover = `"ssdp:discover"`
+
+// Field is a header field of SSDP messages.
+type Field struct {
+	Name  string
+	Value string
+}
+
+// Fields is a list of header fields, which keeps their order.
+type Fields []Field
+
+// Get returns a value of the first field which has the name.  Names are
+// compared case-insensitively.  This returns an empty string when no fields
+// are found.
+func (fs Fields) Get(name string) string {
+	for _, f := range fs {
+		if strings.EqualFold(f.Name, name) {
+			return f.Value
+		}
+	}
+	return ""
+}
+
+// Add appends a field.
+func (fs *Fields) Add(name, value string) {
+	*fs = append(*fs, Field{Name: name, Value: value})
+}
+
+// Set replaces a value of the first field which has the name, and removes
+// other fields with the name.  A field is appended when no fields are found.
+func (fs *Fields) Set(name, value string) {
+	found := false
+	list := (*fs)[:0]
+	for _, f := range *fs {
+		if strings.EqualFold(f.Name, name) {
+			if found {
+				continue
+			}
+			found = true
+			f.Value = value
+		}
+		list = append(list, f)
+	}
+	*fs = list
+	if !found {
+		fs.Add(name, value)
+	}
+}
+
+// Header converts fields to http.Header.
+func (fs Fields) Header() http.Header {
+	h := make(http.Header, len(fs))
+	for _, f := range fs {
+		k := textproto.CanonicalMIMEHeaderKey(f.Name)
+		h[k] = append(h[k], f.Value)
+	}
+	return h
+}
+
+func (fs Fields) write(b *bytes.Buffer) {
+	for _, f := range fs {
+		fmt.Fprintf(b, "%s: %s\r\n", f.Name, f.Value)
+	}
+}
+
+// fieldsInt extracts an integer value of the field.  This returns -1 when
+// the field is not available or invalid.
+func fieldsInt(fs Fields, name string) int {
+	return parseHeaderInt(fs.Get(name))
+}
+
+// Message is a SSDP message: *Notify, *MSearch or *SearchResponse.
+type Message interface {
+	// Marshal builds a packet of the message.
+	Marshal() []byte
+
+	// Header returns all header fields of the message.
+	Header() http.Header
+}
+
+// Notify represents SSDP's NOTIFY message: ssdp:alive, ssdp:byebye and
+// ssdp:update.
+type Notify struct {
+	// Host is a property of "HOST"
+	Host string
+
+	// NT is a property of "NT"
+	NT string
+
+	// NTS is a property of "NTS", one of NTSAlive, NTSByebye or NTSUpdate.
+	NTS string
+
+	// USN is a property of "USN"
+	USN string
+
+	// Location is a property of "LOCATION"
+	Location string
+
+	// Server is a property of "SERVER"
+	Server string
+
+	// CacheControl is a property of "CACHE-CONTROL"
+	CacheControl string
+
+	// Fields is other header fields, like BOOTID.UPNP.ORG and extensions.
+	Fields Fields
+}
+
+func (m *Notify) fields() Fields {
+	fs := make(Fields, 0, 7+len(m.Fields))
+	fs.Add("HOST", m.Host)
+	fs.Add("NT", m.NT)
+	fs.Add("NTS", m.NTS)
+	fs.Add("USN", m.USN)
+	if m.Location != "" {
+		fs.Add("LOCATION", m.Location)
+	}
+	if m.Server != "" {
+		fs.Add("SERVER", m.Server)
+	}
+	if m.CacheControl != "" {
+		fs.Add("CACHE-CONTROL", m.CacheControl)
+	}
+	return append(fs, m.Fields...)
+}
+
+// Marshal builds a packet of the message.  LOCATION, SERVER and
+// CACHE-CONTROL are omitted when they are empty.
+func (m *Notify) Marshal() []byte {
+	return marshal("NOTIFY * HTTP/1.1", m.fields())
+}
+
+// Header returns all header fields of the message.
+func (m *Notify) Header() http.Header {
+	return m.fields().Header()
+}
+
+// MaxAge extracts "max-age" value from "CACHE-CONTROL" property.
+// This returns -1 when the property is not available.
+func (m *Notify) MaxAge() int {
+	return extractMaxAge(m.CacheControl, -1)
+}
+
+// BootID extracts a value of "BOOTID.UPNP.ORG" property.
+// This returns -1 when the property is not available.
+func (m *Notify) BootID() int {
+	return fieldsInt(m.Fields, hdrBootID)
+}
+
+// ConfigID extracts a value of "CONFIGID.UPNP.ORG" property.
+// This returns -1 when the property is not available.
+func (m *Notify) ConfigID() int {
+	return fieldsInt(m.Fields, hdrConfigID)
+}
+
+// SearchPort extracts a value of "SEARCHPORT.UPNP.ORG" property.
+// This returns -1 when the property is not available.
+func (m *Notify) SearchPort() int {
+	return fieldsInt(m.Fields, hdrSearchPort)
+}
+
+// NextBootID extracts a value of "NEXTBOOTID.UPNP.ORG" property.
+// This returns -1 when the property is not available.
+func (m *Notify) NextBootID() int {
+	return fieldsInt(m.Fields, hdrNextBootID)
+}
+
+// MSearch represents SSDP's M-SEARCH message.
+type MSearch struct {
+	// Host is a property of "HOST"
+	Host string
+
+	// MAN is a property of "MAN".  `"ssdp:discover"` is used to marshal
+	// when it is empty.
+	MAN string
+
+	// MX is a property of "MX".  It is 0 when the property is not
+	// available, and -1 when it is invalid.  MX is omitted to marshal when
+	// it is not positive.
+	MX int
+
+	// ST is a property of "ST"
+	ST string
+
+	// Fields is other header fields, like USER-AGENT and extensions.
+	Fields Fields
+}
+
+func (m *MSearch) fields() Fields {
+	fs := make(Fields, 0, 4+len(m.Fields))
+	fs.Add("HOST", m.Host)
+	man := m.MAN
+	if man == "" {
+		man = manDiscover
+	}
+	fs.Add("MAN", man)
+	if m.MX > 0 {
+		fs.Add("MX", strconv.Itoa(m.MX))
+	}
+	fs.Add("ST", m.ST)
+	return append(fs, m.Fields...)
+}
+
+// Marshal builds a packet of the message.
+func (m *MSearch) Marshal() []byte {
+	return marshal("M-SEARCH * HTTP/1.1", m.fields())
+}
+
+// Header returns all header fields of the message.
+func (m *MSearch) Header() http.Header {
+	return m.fields().Header()
+}
+
+// SearchResponse represents a response for M-SEARCH.
+type SearchResponse struct {
+	// ST is a property of "ST"
+	ST string
+
+	// USN is a property of "USN"
+	USN string
+
+	// Location is a property of "LOCATION"
+	Location string
+
+	// Server is a property of "SERVER"
+	Server string
+
+	// CacheControl is a property of "CACHE-CONTROL"
+	CacheControl string
+
+	// Host is a property of "HOST"
+	Host string
+
+	// Fields is other header fields, like BOOTID.UPNP.ORG and extensions.
+	Fields Fields
+}
+
+func (m *SearchResponse) fields() Fields {
+	fs := make(Fields, 0, 7+len(m.Fields))
+	fs.Add("EXT", "")
+	fs.Add("ST", m.ST)
+	fs.Add("USN", m.USN)
+	if m.Location != "" {
+		fs.Add("LOCATION", m.Location)
+	}
+	if m.Server != "" {
+		fs.Add("SERVER", m.Server)
+	}
+	if m.CacheControl != "" {
+		fs.Add("CACHE-CONTROL", m.CacheControl)
+	}
+	if m.Host != "" {
+		fs.Add("HOST", m.Host)
+	}
+	return append(fs, m.Fields...)
+}
+
+// Marshal builds a packet of the message.  LOCATION, SERVER, CACHE-CONTROL
+// and HOST are omitted when they are empty.
+func (m *SearchResponse) Marshal() []byte {
+	return marshal("HTTP/1.1 200 OK", m.fields())
+}
+
+// Header returns all header fields of the message.
+func (m *SearchResponse) Header() http.Header {
+	return m.fields().Header()
+}
+
+// MaxAge extracts "max-age" value from "CACHE-CONTROL" property.
+// This returns -1 when the property is not available.
+func (m *SearchResponse) MaxAge() int {
+	return extractMaxAge(m.CacheControl, -1)
+}
+
+func marshal(line string, fs Fields) []byte {
+	// bytes.Buffer#Write() is never fail, so we can omit error checks.
+	b := new(bytes.Buffer)
+	b.WriteString(line)
+	b.WriteString("\r\n")
+	fs.write(b)
+	b.WriteString("\r\n")
+	return b.Bytes()
+}
+
+// ErrUnknownMessage is returned by ParseMessage for packets which are not
+// NOTIFY, M-SEARCH nor responses.
+var ErrUnknownMessage = errors.New("unknown SSDP message")
+
+// ParseMessage parses a SSDP packet.  It returns *Notify, *MSearch or
+// *SearchResponse.  Header fields which are not properties of the message
+// are stored in Fields with their order.
+func ParseMessage(data []byte) (Message, error) {
+	startLine, fs, err := parseHeader(data)
+	if err != nil {
+		return nil, err
+	}
+	if strings.HasPrefix(startLine, "HTTP/") {
+		return newSearchResponse(fs), nil
+	}
+	method, rest, _ := strings.Cut(startLine, " ")
+	if _, proto, ok := strings.Cut(rest, " "); !ok || !strings.HasPrefix(proto, "HTTP/") {
+		return nil, fmt.Errorf("malformed request line: %q", startLine)
+	}
+	switch method {
+	case "NOTIFY":
+		return newNotify(fs), nil
+	case "M-SEARCH":
+		return newMSearch(fs), nil
+	default:
+		return nil, fmt.Errorf("%w: %q", ErrUnknownMessage, startLine)
+	}
+}
+
+func newNotify(fs Fields) *Notify {
+	m := &Notify{}
+	ext := fs[:0]
+	for _, f := range fs {
+		switch {
+		case isField(f, "HOST"):
+			m.Host = f.Value
+		case isField(f, "NT"):
+			m.NT = f.Value
+		case isField(f, "NTS"):
+			m.NTS = f.Value
+		case isField(f, "USN"):
+			m.USN = f.Value
+		case isField(f, "LOCATION"):
+			m.Location = f.Value
+		case isField(f, "SERVER"):
+			m.Server = f.Value
+		case isField(f, "CACHE-CONTROL"):
+			m.CacheControl = f.Value
+		default:
+			ext = append(ext, f)
+		}
+	}
+	m.Fields = extensions(ext)
+	return m
+}
+
+func newMSearch(fs Fields) *MSearch {
+	m := &MSearch{}
+	ext := fs[:0]
+	for _, f := range fs {
+		switch {
+		case isField(f, "HOST"):
+			m.Host = f.Value
+		case isField(f, "MAN"):
+			m.MAN = f.Value
+		case isField(f, "MX"):
+			mx, err := strconv.Atoi(f.Value)
+			if err != nil || mx < 0 {
+				mx = -1
+			}
+			m.MX = mx
+		case isField(f, "ST"):
+			m.ST = f.Value
+		default:
+			ext = append(ext, f)
+		}
+	}
+	m.Fields = extensions(ext)
+	return m
+}
+
+func newSearchResponse(fs Fields) *SearchResponse {
+	m := &SearchResponse{}
+	ext := fs[:0]
+	for _, f := range fs {
+		switch {
+		case isField(f, "EXT"):
+			// EXT is always added to marshal.
+		case isField(f, "ST"):
+			m.ST = f.Value
+		case isField(f, "USN"):
+			m.USN = f.Value
+		case isField(f, "LOCATION"):
+			m.Location = f.Value
+		case isField(f, "SERVER"):
+			m.Server = f.Value
+		case isField(f, "CACHE-CONTROL"):
+			m.CacheControl = f.Value
+		case isField(f, "HOST"):
+			m.Host = f.Value
+		default:
+			ext = append(ext, f)
+		}
+	}
+	m.Fields = extensions(ext)
+	return m
+}
+
+// isField checks a name of the field case-insensitively.
+func isField(f Field, name string) bool {
+	return len(f.Name) == len(name) && strings.EqualFold(f.Name, name)
+}
+
+// extensions returns fields which are not properties, or nil when empty.
+func extensions(fs Fields) Fields {
+	if len(fs) == 0 {
+		return nil
+	}
+	return fs
+}
+
+// startLine returns the first line of a packet.
+func startLine(data []byte) string {
+	line, _, _ := bytes.Cut(data, []byte{'\n'})
+	return string(bytes.TrimRight(line, "\r"))
+}
+
+// headerValue returns a value of the first header field which has the name
+// in a packet, without parsing all of it.  This returns an empty string when
+// the field is not found.
+func headerValue(data []byte, name string) string {
+	_, rest, _ := bytes.Cut(data, []byte{'\n'})
+	for len(rest) > 0 {
+		var line []byte
+		line, rest, _ = bytes.Cut(rest, []byte{'\n'})
+		line = bytes.TrimSuffix(line, []byte{'\r'})
+		if len(line) == 0 {
+			break
+		}
+		k, v, ok := bytes.Cut(line, []byte{':'})
+		if ok && len(k) == len(name) && bytes.EqualFold(k, []byte(name)) {
+			return string(bytes.TrimSpace(v))
+		}
+	}
+	return ""
+}
+
+// parseHeader parses a start line and header fields of a packet.  A tail
+// of header may lack an empty line, for buggy SSDP implementations.  Lines
+// may be terminated by LF only.
+// The packet is copied to a string once, and names and values of fields
+// refer to it, to reduce allocations.
+func parseHeader(data []byte) (string, Fields, error) {
+	s := string(data)
+	first, rest, _ := strings.Cut(s, "\n")
+	first = strings.TrimSuffix(first, "\r")
+	if first == "" {
+		return "", nil, errors.New("empty message")
+	}
+	fs := make(Fields, 0, strings.Count(rest, "\n")+1)
+	for rest != "" {
+		var line string
+		line, rest, _ = strings.Cut(rest, "\n")
+		line = strings.TrimSuffix(line, "\r")
+		if line == "" {
+			break
+		}
+		// continuation of the previous field.
+		if line[0] == ' ' || line[0] == '\t' {
+			if len(fs) == 0 {
+				return "", nil, fmt.Errorf("malformed header line: %q", line)
+			}
+			last := &fs[len(fs)-1]
+			last.Value = strings.TrimSpace(last.Value + " " + strings.TrimSpace(line))
+			continue
+		}
+		name, value, ok := strings.Cut(line, ":")
+		if !ok || name == "" || strings.ContainsAny(name, " \t") {
+			return "", nil, fmt.Errorf("malformed header line: %q", line)
+		}
+		fs = append(fs, Field{Name: name, Value: strings.TrimSpace(value)})
+	}
+	return first, fs, nil
+}
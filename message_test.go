@@ -0,0 +1,264 @@
+package ssdp
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+func TestParseMessage(t *testing.T) {
+	for i, tc := range []struct {
+		in   string
+		want Message
+	}{
+		{
+			"NOTIFY * HTTP/1.1\r\n" +
+				"HOST: 239.255.255.250:1900\r\n" +
+				"NT: upnp:rootdevice\r\n" +
+				"NTS: ssdp:alive\r\n" +
+				"USN: uuid:1::upnp:rootdevice\r\n" +
+				"LOCATION: http://192.0.2.1/desc.xml\r\n" +
+				"SERVER: go-ssdp\r\n" +
+				"CACHE-CONTROL: max-age=1800\r\n" +
+				"BOOTID.UPNP.ORG: 3\r\n" +
+				"X-Foo: foo\r\n" +
+				"\r\n",
+			&Notify{
+				Host:         "239.255.255.250:1900",
+				NT:           "upnp:rootdevice",
+				NTS:          NTSAlive,
+				USN:          "uuid:1::upnp:rootdevice",
+				Location:     "http://192.0.2.1/desc.xml",
+				Server:       "go-ssdp",
+				CacheControl: "max-age=1800",
+				Fields: Fields{
+					{"BOOTID.UPNP.ORG", "3"},
+					{"X-Foo", "foo"},
+				},
+			},
+		},
+		{
+			"M-SEARCH * HTTP/1.1\r\n" +
+				"HOST: 239.255.255.250:1900\r\n" +
+				"MAN: \"ssdp:discover\"\r\n" +
+				"MX: 3\r\n" +
+				"ST: ssdp:all\r\n" +
+				"USER-AGENT: test\r\n" +
+				"\r\n",
+			&MSearch{
+				Host:   "239.255.255.250:1900",
+				MAN:    `"ssdp:discover"`,
+				MX:     3,
+				ST:     All,
+				Fields: Fields{{"USER-AGENT", "test"}},
+			},
+		},
+		// lower case names, LF only and without an empty line.
+		{
+			"HTTP/1.1 200 OK\n" +
+				"ext:\n" +
+				"st: upnp:rootdevice\n" +
+				"usn: uuid:1::upnp:rootdevice\n" +
+				"location: http://192.0.2.1/desc.xml\n" +
+				"cache-control: max-age=600\n" +
+				"date: Mon, 01 Jan 2024 00:00:00 GMT",
+			&SearchResponse{
+				ST:           RootDevice,
+				USN:          "uuid:1::upnp:rootdevice",
+				Location:     "http://192.0.2.1/desc.xml",
+				CacheControl: "max-age=600",
+				Fields:       Fields{{"date", "Mon, 01 Jan 2024 00:00:00 GMT"}},
+			},
+		},
+		// invalid MX
+		{
+			"M-SEARCH * HTTP/1.1\r\nMX: foo\r\nST: ssdp:all\r\n\r\n",
+			&MSearch{MX: -1, ST: All},
+		},
+	} {
+		got, err := ParseMessage([]byte(tc.in))
+		if err != nil {
+			t.Errorf("#%d failed to parse: %s", i, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("#%d unexpected message:\nwant=%+v\ngot=%+v", i, tc.want, got)
+		}
+	}
+}
+
+func TestParseMessage_Error(t *testing.T) {
+	for i, tc := range []struct {
+		in      string
+		unknown bool
+	}{
+		{"", false},
+		{"GET / HTTP/1.1\r\n\r\n", true},
+		{"NOTIFY *\r\n\r\n", false},
+		{"NOTIFY * HTTP/1.1\r\nNT upnp:rootdevice\r\n\r\n", false},
+		{"NOTIFY * HTTP/1.1\r\n continued\r\n\r\n", false},
+	} {
+		_, err := ParseMessage([]byte(tc.in))
+		if err == nil {
+			t.Errorf("#%d ParseMessage(%q) should fail", i, tc.in)
+			continue
+		}
+		if got := errors.Is(err, ErrUnknownMessage); got != tc.unknown {
+			t.Errorf("#%d unexpected error: %s", i, err)
+		}
+	}
+}
+
+func TestMessage_RoundTrip(t *testing.T) {
+	for i, m := range []Message{
+		&Notify{
+			Host:   "[ff02::c]:1900",
+			NT:     "urn:schemas-upnp-org:device:Basic:1",
+			NTS:    NTSUpdate,
+			USN:    "uuid:1::urn:schemas-upnp-org:device:Basic:1",
+			Fields: Fields{{"X-B", "2"}, {hdrNextBootID, "4"}, {"X-A", "1"}},
+		},
+		&MSearch{
+			Host:   "192.0.2.1:1900",
+			MAN:    manDiscover,
+			ST:     RootDevice,
+			Fields: Fields{{"X-Z", "z"}, {"X-Y", "y"}},
+		},
+		&SearchResponse{
+			ST:           All,
+			USN:          "uuid:1",
+			Location:     "http://192.0.2.1/desc.xml",
+			Server:       "go-ssdp",
+			CacheControl: "max-age=1800",
+			Host:         "239.255.255.250:1900",
+			Fields:       Fields{{hdrBootID, "1"}, {"X-Ext", "a b c"}},
+		},
+	} {
+		got, err := ParseMessage(m.Marshal())
+		if err != nil {
+			t.Errorf("#%d failed to parse: %s", i, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, m) {
+			t.Errorf("#%d round trip mismatch:\nwant=%+v\ngot=%+v", i, m, got)
+		}
+	}
+}
+
+func TestNotify_Marshal(t *testing.T) {
+	m := &Notify{
+		Host:   "239.255.255.250:1900",
+		NT:     "upnp:rootdevice",
+		NTS:    NTSByebye,
+		USN:    "uuid:1::upnp:rootdevice",
+		Fields: Fields{{hdrBootID, "7"}},
+	}
+	want := "NOTIFY * HTTP/1.1\r\n" +
+		"HOST: 239.255.255.250:1900\r\n" +
+		"NT: upnp:rootdevice\r\n" +
+		"NTS: ssdp:byebye\r\n" +
+		"USN: uuid:1::upnp:rootdevice\r\n" +
+		"BOOTID.UPNP.ORG: 7\r\n" +
+		"\r\n"
+	if got := string(m.Marshal()); got != want {
+		t.Errorf("unexpected packet:\nwant=%q\ngot=%q", want, got)
+	}
+	if got := m.BootID(); got != 7 {
+		t.Errorf("unexpected BOOTID: want=7 got=%d", got)
+	}
+	if got := m.Header().Get("Nts"); got != NTSByebye {
+		t.Errorf("unexpected NTS in header: %q", got)
+	}
+}
+
+func TestFields(t *testing.T) {
+	var fs Fields
+	fs.Add("X-A", "1")
+	fs.Add("X-B", "2")
+	fs.Add("x-a", "3")
+	if got := fs.Get("x-A"); got != "1" {
+		t.Errorf("unexpected value: want=1 got=%s", got)
+	}
+	fs.Set("X-A", "4")
+	fs.Set("X-C", "5")
+	want := Fields{{"X-A", "4"}, {"X-B", "2"}, {"X-C", "5"}}
+	if !reflect.DeepEqual(fs, want) {
+		t.Errorf("unexpected fields:\nwant=%+v\ngot=%+v", want, fs)
+	}
+	if got := fs.Get("X-D"); got != "" {
+		t.Errorf("unexpected value for missing field: %s", got)
+	}
+}
+
+var benchNotify = []byte("NOTIFY * HTTP/1.1\r\n" +
+	"HOST: 239.255.255.250:1900\r\n" +
+	"CACHE-CONTROL: max-age=1800\r\n" +
+	"LOCATION: http://192.0.2.1:49152/description.xml\r\n" +
+	"NT: urn:schemas-upnp-org:device:MediaServer:1\r\n" +
+	"NTS: ssdp:alive\r\n" +
+	"SERVER: Linux/5.10 UPnP/1.1 go-ssdp/1.0\r\n" +
+	"USN: uuid:11111111-2222-3333-4444-555555555555::urn:schemas-upnp-org:device:MediaServer:1\r\n" +
+	"BOOTID.UPNP.ORG: 12\r\n" +
+	"CONFIGID.UPNP.ORG: 1\r\n" +
+	"\r\n")
+
+var benchResponse = []byte("HTTP/1.1 200 OK\r\n" +
+	"CACHE-CONTROL: max-age=1800\r\n" +
+	"EXT:\r\n" +
+	"LOCATION: http://192.0.2.1:49152/description.xml\r\n" +
+	"SERVER: Linux/5.10 UPnP/1.1 go-ssdp/1.0\r\n" +
+	"ST: upnp:rootdevice\r\n" +
+	"USN: uuid:11111111-2222-3333-4444-555555555555::upnp:rootdevice\r\n" +
+	"BOOTID.UPNP.ORG: 12\r\n" +
+	"\r\n")
+
+func BenchmarkParseMessage_Notify(b *testing.B) {
+	b.ReportAllocs()
+	for range b.N {
+		if _, err := ParseMessage(benchNotify); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkParseMessage_Response(b *testing.B) {
+	b.ReportAllocs()
+	for range b.N {
+		if _, err := ParseMessage(benchResponse); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkHTTP_ReadRequest measures a previous way to parse NOTIFY with
+// net/http, for comparison.
+func BenchmarkHTTP_ReadRequest(b *testing.B) {
+	b.ReportAllocs()
+	for range b.N {
+		raw := bytes.Join([][]byte{benchNotify, endOfHeader}, nil)
+		req, err := http.ReadRequest(bufio.NewReader(bytes.NewReader(raw)))
+		if err != nil {
+			b.Fatal(err)
+		}
+		_ = req.Header.Get("NTS")
+	}
+}
+
+// BenchmarkHTTP_ReadResponse measures a previous way to parse responses with
+// net/http, for comparison.
+func BenchmarkHTTP_ReadResponse(b *testing.B) {
+	b.ReportAllocs()
+	for range b.N {
+		resp, err := http.ReadResponse(bufio.NewReader(bytes.NewReader(benchResponse)), nil)
+		if err != nil {
+			b.Fatal(err)
+		}
+		resp.Body.Close()
+		_ = resp.Header.Get("ST")
+	}
+}
+
+var endOfHeader = []byte{'\r', '\n', '\r', '\n'}
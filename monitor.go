@@ -1,29 +1,43 @@
 package ssdp
 
 import (
-	"bufio"
 	"bytes"
 	"errors"
-	"fmt"
 	"io"
 	"net"
 	"net/http"
 	"sync"
+	"sync/atomic"
 
-	"github.com/koron/go-ssdp/internal/multicast"
 	"github.com/koron/go-ssdp/internal/ssdplog"
 )
 
-// Monitor monitors SSDP's alive and byebye messages.
+// Monitor monitors SSDP's alive, byebye and update messages.
 type Monitor struct {
 	Alive  AliveHandler
 	Bye    ByeHandler
 	Search SearchHandler
+	Update UpdateHandler
 
 	Options []Option
 
-	conn *multicast.Conn
+	// mu guards conn and done for Close().
+	mu   sync.Mutex
+	conn TransportConn
 	wg   sync.WaitGroup
+	done chan struct{}
+	log  *ssdplog.Logger
+	errs errorReporter
+	pool *workerPool
+	cfg  monitorConfig
+
+	filter   *sourceFilter
+	filtered atomic.Uint64
+
+	// stopped is closed when receiving packets stopped, and err is an error
+	// which stopped it.
+	stopped chan struct{}
+	err     error
 }
 
 // Start starts to monitor SSDP messages.
@@ -32,122 +46,236 @@ func (m *Monitor) Start() error {
 	if err != nil {
 		return err
 	}
-	conn, err := multicast.Listen(multicast.RecvAddrResolver, cfg.multicastConfig.options()...)
+	conn, err := cfg.multicastConfig.transport().ListenMulticast()
 	if err != nil {
 		return err
 	}
-	ssdplog.Printf("monitoring on %s", conn.LocalAddr().String())
+	cfg.log.Info("SSDP monitor", ssdplog.KeyEvent, "monitor", "local", conn.LocalAddr().String())
 	m.conn = conn
+	m.log = cfg.log
+	m.errs = errorReporter{h: cfg.errorHandler, log: cfg.log}
+	m.done = make(chan struct{})
+	m.stopped = make(chan struct{})
+	m.err = nil
+	m.cfg = cfg.monitorConfig
+	m.filter = newSourceFilter(cfg.filterConfig)
+	m.filtered.Store(0)
+	m.pool = newWorkerPool(m.cfg, m.done, m.handleJob)
 	m.wg.Add(1)
 	go func() {
-		m.serve()
-		m.wg.Done()
+		defer m.wg.Done()
+		err := m.serve()
+		m.pool.close()
+		if err != nil {
+			m.err = err
+			m.errs.report("monitor", err)
+		}
+		close(m.stopped)
 	}()
+	if d := cfg.multicastConfig.interfaceWatchInterval(); d > 0 {
+		m.wg.Add(1)
+		go func() {
+			watchInterfaces(conn, d, m.done, m.log, nil)
+			m.wg.Done()
+		}()
+	}
 	return nil
 }
 
 func (m *Monitor) serve() error {
-	// TODO: update listening interfaces of m.conn
-	err := m.conn.ReadPackets(0, func(addr net.Addr, data []byte) error {
-		msg := make([]byte, len(data))
-		copy(msg, data)
-		go m.handleRaw(addr, msg)
+	err := m.conn.ReadPackets(0, func(addr net.Addr, data []byte, ifi *net.Interface, dst net.Addr) error {
+		src := newSource(addr, ifi, dst)
+		if !m.filter.accept(src) {
+			m.filtered.Add(1)
+			m.log.Debug("filtered packet", ssdplog.KeyEvent, "monitor", ssdplog.KeyFrom, addr.String(), ssdplog.KeyInterface, interfaceName(ifi))
+			return nil
+		}
+		m.pool.push(m.orderKey(src, data), job{src: src, raw: bytes.Clone(data)})
 		return nil
 	})
 	if err != nil && !errors.Is(err, io.EOF) {
-		return err
+		return &ReadError{Err: err}
 	}
 	return nil
 }
 
-func (m *Monitor) handleRaw(addr net.Addr, raw []byte) error {
-	// Add newline to workaround buggy SSDP responses
-	if !bytes.HasSuffix(raw, endOfHeader) {
-		raw = bytes.Join([][]byte{raw, endOfHeader}, nil)
+// orderKey returns a key to deliver messages in order.
+func (m *Monitor) orderKey(src Source, raw []byte) string {
+	switch m.cfg.order {
+	case OrderBySource:
+		if a, ok := src.From.(*net.UDPAddr); ok {
+			return a.IP.String()
+		}
+		return src.From.String()
+	case OrderByUSN:
+		return headerValue(raw, "USN")
+	default:
+		return ""
 	}
-	if bytes.HasPrefix(raw, []byte("M-SEARCH ")) {
-		return m.handleSearch(addr, raw)
+}
+
+// handleJob handles a received packet in a worker.  Packets which are
+// queued are discarded after Close().
+func (m *Monitor) handleJob(j job) {
+	select {
+	case <-m.done:
+		return
+	default:
 	}
-	if bytes.HasPrefix(raw, []byte("NOTIFY ")) {
-		return m.handleNotify(addr, raw)
+	if err := m.handleRaw(j.src, j.raw); err != nil {
+		m.errs.report("monitor", err)
 	}
-	n := bytes.Index(raw, []byte("\r\n"))
-	ssdplog.Printf("unexpected method: %q", string(raw[:n]))
-	return nil
 }
 
-func (m *Monitor) handleNotify(addr net.Addr, raw []byte) error {
-	req, err := http.ReadRequest(bufio.NewReader(bytes.NewReader(raw)))
+func (m *Monitor) handleRaw(src Source, raw []byte) error {
+	msg, err := ParseMessage(raw)
 	if err != nil {
-		return err
+		return &ParseError{From: src.From, Raw: raw, Err: err}
 	}
-	switch nts := req.Header.Get("NTS"); nts {
-	case "ssdp:alive":
-		if req.Method != "NOTIFY" {
-			return fmt.Errorf("unexpected method for %q: %s", "ssdp:alive", req.Method)
-		}
+	switch msg := msg.(type) {
+	case *MSearch:
+		return m.handleSearch(src, msg)
+	case *Notify:
+		return m.handleNotify(src, msg)
+	}
+	m.log.Warn("unexpected method", ssdplog.KeyEvent, "monitor", ssdplog.KeyFrom, src.From.String(), "method", startLine(raw))
+	return nil
+}
+
+func (m *Monitor) handleNotify(src Source, msg *Notify) error {
+	switch msg.NTS {
+	case NTSAlive:
 		if h := m.Alive; h != nil {
 			h(&AliveMessage{
-				From:      addr,
-				Type:      req.Header.Get("NT"),
-				USN:       req.Header.Get("USN"),
-				Location:  req.Header.Get("LOCATION"),
-				Server:    req.Header.Get("SERVER"),
-				rawHeader: req.Header,
+				From:      src.From,
+				Interface: src.Interface,
+				LocalAddr: src.LocalAddr,
+				Type:      msg.NT,
+				USN:       msg.USN,
+				Location:  msg.Location,
+				Server:    msg.Server,
+				rawHeader: requestHeader(msg),
 			})
 		}
-	case "ssdp:byebye":
-		if req.Method != "NOTIFY" {
-			return fmt.Errorf("unexpected method for %q: %s", "ssdp:byebye", req.Method)
-		}
+	case NTSByebye:
 		if h := m.Bye; h != nil {
 			h(&ByeMessage{
-				From:      addr,
-				Type:      req.Header.Get("NT"),
-				USN:       req.Header.Get("USN"),
-				rawHeader: req.Header,
+				From:      src.From,
+				Interface: src.Interface,
+				LocalAddr: src.LocalAddr,
+				Type:      msg.NT,
+				USN:       msg.USN,
+				rawHeader: requestHeader(msg),
+			})
+		}
+	case NTSUpdate:
+		if h := m.Update; h != nil {
+			h(&UpdateMessage{
+				From:      src.From,
+				Interface: src.Interface,
+				LocalAddr: src.LocalAddr,
+				Type:      msg.NT,
+				USN:       msg.USN,
+				Location:  msg.Location,
+				rawHeader: requestHeader(msg),
 			})
 		}
 	default:
-		return fmt.Errorf("unknown NTS: %s", nts)
+		return &UnknownNTSError{From: src.From, NTS: msg.NTS}
 	}
 	return nil
 }
 
-func (m *Monitor) handleSearch(addr net.Addr, raw []byte) error {
-	req, err := http.ReadRequest(bufio.NewReader(bytes.NewReader(raw)))
-	if err != nil {
-		return err
-	}
-	man := req.Header.Get("MAN")
-	if man != `"ssdp:discover"` {
-		return fmt.Errorf("unexpected MAN: %s", man)
+func (m *Monitor) handleSearch(src Source, msg *MSearch) error {
+	if msg.MAN != manDiscover {
+		return &UnexpectedMANError{From: src.From, MAN: msg.MAN}
 	}
 	if h := m.Search; h != nil {
 		h(&SearchMessage{
-			From:      addr,
-			Type:      req.Header.Get("ST"),
-			rawHeader: req.Header,
+			From:      src.From,
+			Interface: src.Interface,
+			LocalAddr: src.LocalAddr,
+			Type:      msg.ST,
+			rawHeader: requestHeader(msg),
 		})
 	}
 	return nil
 }
 
-// Close closes monitoring.
+// requestHeader returns header fields of a request message without HOST,
+// same as http.Request.Header for compatibility.
+func requestHeader(msg Message) http.Header {
+	h := msg.Header()
+	h.Del("Host")
+	return h
+}
+
+// Done returns a channel which is closed when the monitor stops receiving
+// packets, by Close() or a fatal error.  This returns nil before Start().
+func (m *Monitor) Done() <-chan struct{} {
+	return m.stopped
+}
+
+// Err returns an error which stopped the monitor, it is a *ReadError.
+// This returns nil while the monitor is running, or when it is stopped by
+// Close().
+func (m *Monitor) Err() error {
+	select {
+	case <-m.stopped:
+		return m.err
+	default:
+		return nil
+	}
+}
+
+// Stats returns statistics of received packets.
+func (m *Monitor) Stats() MonitorStats {
+	if m.pool == nil {
+		return MonitorStats{}
+	}
+	st := m.pool.stats()
+	st.Filtered = m.filtered.Load()
+	return st
+}
+
+// Close closes monitoring.  It doesn't wait for handlers which are running,
+// so it can be called from a handler.  No messages are delivered after
+// handlers which are running return.  Use Wait() to wait for them.
 func (m *Monitor) Close() error {
-	if m.conn != nil {
-		m.conn.Close()
+	m.mu.Lock()
+	conn := m.conn
+	if conn != nil {
+		close(m.done)
+		conn.Close()
 		m.conn = nil
-		m.wg.Wait()
 	}
+	m.mu.Unlock()
+	m.wg.Wait() // receiving and watching interfaces, which never call handlers.
 	return nil
 }
 
+// Wait waits for monitoring to stop by Close() or a fatal error, and for
+// handlers to return.  It must not be called from a handler.
+func (m *Monitor) Wait() {
+	m.wg.Wait()
+	if m.pool != nil {
+		m.pool.wait()
+	}
+}
+
 // AliveMessage represents SSDP's ssdp:alive message.
 type AliveMessage struct {
 	// From is a sender of this message
 	From net.Addr
 
+	// Interface is a local interface which received this message.
+	// It is nil when unknown.
+	Interface *net.Interface
+
+	// LocalAddr is a destination address of this message, it may be a
+	// multicast group address.  It is nil when unknown.
+	LocalAddr net.Addr
+
 	// Type is a property of "NT"
 	Type string
 
@@ -178,6 +306,24 @@ func (m *AliveMessage) MaxAge() int {
 	return *m.maxAge
 }
 
+// BootID extracts a value of "BOOTID.UPNP.ORG" property.
+// This returns -1 when the property is not available.
+func (m *AliveMessage) BootID() int {
+	return headerInt(m.rawHeader, hdrBootID)
+}
+
+// ConfigID extracts a value of "CONFIGID.UPNP.ORG" property.
+// This returns -1 when the property is not available.
+func (m *AliveMessage) ConfigID() int {
+	return headerInt(m.rawHeader, hdrConfigID)
+}
+
+// SearchPort extracts a value of "SEARCHPORT.UPNP.ORG" property.
+// This returns -1 when the property is not available.
+func (m *AliveMessage) SearchPort() int {
+	return headerInt(m.rawHeader, hdrSearchPort)
+}
+
 // AliveHandler is handler of Alive message.
 type AliveHandler func(*AliveMessage)
 
@@ -186,6 +332,14 @@ type ByeMessage struct {
 	// From is a sender of this message
 	From net.Addr
 
+	// Interface is a local interface which received this message.
+	// It is nil when unknown.
+	Interface *net.Interface
+
+	// LocalAddr is a destination address of this message, it may be a
+	// multicast group address.  It is nil when unknown.
+	LocalAddr net.Addr
+
 	// Type is a property of "NT"
 	Type string
 
@@ -200,12 +354,98 @@ func (m *ByeMessage) Header() http.Header {
 	return m.rawHeader
 }
 
+// BootID extracts a value of "BOOTID.UPNP.ORG" property.
+// This returns -1 when the property is not available.
+func (m *ByeMessage) BootID() int {
+	return headerInt(m.rawHeader, hdrBootID)
+}
+
+// ConfigID extracts a value of "CONFIGID.UPNP.ORG" property.
+// This returns -1 when the property is not available.
+func (m *ByeMessage) ConfigID() int {
+	return headerInt(m.rawHeader, hdrConfigID)
+}
+
+// SearchPort extracts a value of "SEARCHPORT.UPNP.ORG" property.
+// This returns -1 when the property is not available.
+func (m *ByeMessage) SearchPort() int {
+	return headerInt(m.rawHeader, hdrSearchPort)
+}
+
 // ByeHandler is handler of Bye message.
 type ByeHandler func(*ByeMessage)
 
+// UpdateMessage represents SSDP's ssdp:update message.
+type UpdateMessage struct {
+	// From is a sender of this message
+	From net.Addr
+
+	// Interface is a local interface which received this message.
+	// It is nil when unknown.
+	Interface *net.Interface
+
+	// LocalAddr is a destination address of this message, it may be a
+	// multicast group address.  It is nil when unknown.
+	LocalAddr net.Addr
+
+	// Type is a property of "NT"
+	Type string
+
+	// USN is a property of "USN"
+	USN string
+
+	// Location is a property of "LOCATION"
+	Location string
+
+	rawHeader http.Header
+}
+
+// Header returns all properties in update message.
+func (m *UpdateMessage) Header() http.Header {
+	return m.rawHeader
+}
+
+// BootID extracts a value of "BOOTID.UPNP.ORG" property.
+// This returns -1 when the property is not available.
+func (m *UpdateMessage) BootID() int {
+	return headerInt(m.rawHeader, hdrBootID)
+}
+
+// ConfigID extracts a value of "CONFIGID.UPNP.ORG" property.
+// This returns -1 when the property is not available.
+func (m *UpdateMessage) ConfigID() int {
+	return headerInt(m.rawHeader, hdrConfigID)
+}
+
+// SearchPort extracts a value of "SEARCHPORT.UPNP.ORG" property.
+// This returns -1 when the property is not available.
+func (m *UpdateMessage) SearchPort() int {
+	return headerInt(m.rawHeader, hdrSearchPort)
+}
+
+// NextBootID extracts a value of "NEXTBOOTID.UPNP.ORG" property.
+// This returns -1 when the property is not available.
+func (m *UpdateMessage) NextBootID() int {
+	return headerInt(m.rawHeader, hdrNextBootID)
+}
+
+// UpdateHandler is handler of Update message.
+type UpdateHandler func(*UpdateMessage)
+
 // SearchMessage represents SSDP's ssdp:discover message.
 type SearchMessage struct {
+	// From is a sender of this message
 	From net.Addr
+
+	// Interface is a local interface which received this message.
+	// It is nil when unknown.
+	Interface *net.Interface
+
+	// LocalAddr is a destination address of this message, it may be a
+	// multicast group address.  It is nil when unknown.
+	LocalAddr net.Addr
+
+	// Type is a property of "ST"
 	Type string
 
 	rawHeader http.Header
@@ -1,14 +1,20 @@
 package ssdp
 
 import (
+	"net"
+	"sync"
 	"testing"
 	"time"
 )
 
 const monitorWait = 500 * time.Millisecond
 
-func newTestMonitor(t *testing.T, typ string, alive AliveHandler, bye ByeHandler, search SearchHandler) *Monitor {
-	m := &Monitor{}
+func newTestMonitor(t *testing.T, typ string, alive AliveHandler, bye ByeHandler, search SearchHandler, opts ...Option) *Monitor {
+	return newTestMonitorWithUpdate(t, typ, alive, bye, search, nil, opts...)
+}
+
+func newTestMonitorWithUpdate(t *testing.T, typ string, alive AliveHandler, bye ByeHandler, search SearchHandler, update UpdateHandler, opts ...Option) *Monitor {
+	m := &Monitor{Options: opts}
 	if alive != nil {
 		m.Alive = func(am *AliveMessage) {
 			if am.Type == typ {
@@ -30,6 +36,13 @@ func newTestMonitor(t *testing.T, typ string, alive AliveHandler, bye ByeHandler
 			}
 		}
 	}
+	if update != nil {
+		m.Update = func(um *UpdateMessage) {
+			if um.Type == typ {
+				update(um)
+			}
+		}
+	}
 	if err := m.Start(); err != nil {
 		t.Helper()
 		t.Fatalf("failed to start Monitor: %s", err)
@@ -39,3 +52,44 @@ func newTestMonitor(t *testing.T, typ string, alive AliveHandler, bye ByeHandler
 	})
 	return m
 }
+
+func TestMonitor_Source(t *testing.T) {
+	var mu sync.Mutex
+	var mm []*AliveMessage
+	m := newTestMonitor(t, "test:monitor+source", func(m *AliveMessage) {
+		mu.Lock()
+		mm = append(mm, m)
+		mu.Unlock()
+	}, nil, nil)
+
+	err := AnnounceAlive("test:monitor+source", "usn:monitor+source", "location:monitor+source", "server:monitor+source", 600, "")
+	if err != nil {
+		t.Fatalf("failed to announce alive: %s", err)
+	}
+
+	time.Sleep(monitorWait)
+	m.Close()
+
+	mu.Lock()
+	t.Cleanup(mu.Unlock)
+
+	if len(mm) < 1 {
+		t.Fatal("no alives detected")
+	}
+	for i, m := range mm {
+		if m.From == nil {
+			t.Errorf("no senders for alive#%d", i)
+		}
+		if m.Interface == nil {
+			t.Errorf("no interfaces for alive#%d", i)
+		}
+		laddr, ok := m.LocalAddr.(*net.UDPAddr)
+		if !ok {
+			t.Errorf("unexpected local address for alive#%d: %+v", i, m.LocalAddr)
+			continue
+		}
+		if !laddr.IP.Equal(net.IPv4(239, 255, 255, 250)) || laddr.Port != 1900 {
+			t.Errorf("unexpected local address for alive#%d: want=%s got=%s", i, "239.255.255.250:1900", laddr)
+		}
+	}
+}
@@ -1,10 +1,25 @@
 package ssdp
 
-import "github.com/koron/go-ssdp/internal/multicast"
+import (
+	"fmt"
+	"log"
+	"log/slog"
+	"net"
+	"time"
+
+	"github.com/koron/go-ssdp/internal/multicast"
+	"github.com/koron/go-ssdp/internal/ssdplog"
+)
 
 type config struct {
 	multicastConfig
 	advertiseConfig
+	udaConfig
+	scheduleConfig
+	searchConfig
+	errorConfig
+	monitorConfig
+	filterConfig
 }
 
 func opts2config(opts []Option) (cfg config, err error) {
@@ -18,8 +33,31 @@ func opts2config(opts []Option) (cfg config, err error) {
 }
 
 type multicastConfig struct {
-	ttl   int
-	sysIf bool
+	ttl     int
+	sysIf   bool
+	family  multicast.Family
+	groups6 []net.IP
+
+	// watchInterval is an interval to poll network interfaces.  Negative
+	// value disables polling.
+	watchInterval time.Duration
+
+	ifis     []net.Interface
+	recvAddr string
+	sendAddr string
+	port     int
+	log      *ssdplog.Logger
+
+	// tr is a Transport which is given by UseTransport().
+	tr Transport
+}
+
+// transport returns a Transport to open connections.
+func (mc multicastConfig) transport() Transport {
+	if mc.tr != nil {
+		return mc.tr
+	}
+	return udpTransport{cfg: mc}
 }
 
 func (mc multicastConfig) options() (opts []multicast.ConnOption) {
@@ -29,11 +67,59 @@ func (mc multicastConfig) options() (opts []multicast.ConnOption) {
 	if mc.sysIf {
 		opts = append(opts, multicast.ConnSystemAssginedInterface())
 	}
+	if mc.family != 0 {
+		opts = append(opts, multicast.ConnFamily(mc.family))
+	}
+	if len(mc.groups6) > 0 {
+		opts = append(opts, multicast.ConnGroupsIPv6(mc.groups6))
+	}
+	if len(mc.ifis) > 0 {
+		opts = append(opts, multicast.ConnInterfaces(mc.ifis))
+	}
+	if mc.sendAddr != "" {
+		opts = append(opts, multicast.ConnSendAddrIPv4(mc.sendAddr))
+	}
+	if mc.port > 0 {
+		opts = append(opts, multicast.ConnPort(mc.port))
+	}
+	if mc.log != nil {
+		opts = append(opts, multicast.ConnLogger(mc.log))
+	}
 	return opts
 }
 
+// recvAddrResolver returns an AddrResolver to receive multicast packets.
+func (mc multicastConfig) recvAddrResolver() *multicast.AddrResolver {
+	if mc.recvAddr == "" && mc.port <= 0 {
+		return multicast.RecvAddrResolver
+	}
+	return multicast.NewRecvAddrResolver(mc.recvAddr, mc.port)
+}
+
+// defaultWatchInterval is a default interval to poll network interfaces.
+const defaultWatchInterval = 10 * time.Second
+
+// interfaceWatchInterval returns an interval to poll network interfaces.
+// This returns 0 when polling is disabled.
+func (mc multicastConfig) interfaceWatchInterval() time.Duration {
+	switch {
+	case mc.watchInterval < 0:
+		return 0
+	case mc.watchInterval == 0:
+		return defaultWatchInterval
+	default:
+		return mc.watchInterval
+	}
+}
+
 type advertiseConfig struct {
 	addHost bool
+
+	perSourceLimit rateLimit
+	globalLimit    rateLimit
+	localOnly      bool
+	admission      AdmissionPolicy
+	maxPending     int
 }
 
 // Option is option set for SSDP API.
@@ -64,6 +150,238 @@ func OnlySystemInterface() Option {
 	})
 }
 
+type searchConfig struct {
+	acceptAnyST       bool
+	searchTypes       []string
+	retransmit        int
+	retransmitSpacing time.Duration
+}
+
+// IPv6 returns as Option that using IPv6 instead of IPv4.
+func IPv6() Option {
+	return optionFunc(func(c *config) error {
+		c.family = multicast.IPv6
+		return nil
+	})
+}
+
+// DualStack returns as Option that using both IPv4 and IPv6.
+func DualStack() Option {
+	return optionFunc(func(c *config) error {
+		c.family = multicast.DualStack
+		return nil
+	})
+}
+
+// IPv6Scopes returns as Option that set multicast addresses for IPv6.
+// Each address should be one of IPv6LinkLocal, IPv6SiteLocal or
+// IPv6OrganizationLocal.  IPv6LinkLocal is used when this is omitted.
+// This option works with IPv6() or DualStack() options.
+func IPv6Scopes(addrs ...string) Option {
+	return optionFunc(func(c *config) error {
+		groups := make([]net.IP, 0, len(addrs))
+		for _, s := range addrs {
+			ip := net.ParseIP(s)
+			if ip == nil || ip.To4() != nil || !ip.IsMulticast() {
+				return fmt.Errorf("not an IPv6 multicast address: %q", s)
+			}
+			groups = append(groups, ip)
+		}
+		c.groups6 = groups
+		return nil
+	})
+}
+
+// WatchInterfaces returns as Option that sets an interval to poll network
+// interfaces.  Advertiser and Monitor follow changes of interfaces by
+// polling, and Advertiser sends alive on interfaces which appeared.
+// Polling is disabled when d is zero or less.  Default is 10 seconds.
+func WatchInterfaces(d time.Duration) Option {
+	return optionFunc(func(c *config) error {
+		if d <= 0 {
+			d = -1
+		}
+		c.watchInterval = d
+		return nil
+	})
+}
+
+// UseInterfaces returns as Option that set interfaces to multicast.
+// Interfaces variable is used when this is omitted.
+func UseInterfaces(ifis ...net.Interface) Option {
+	return optionFunc(func(c *config) error {
+		c.ifis = ifis
+		return nil
+	})
+}
+
+// MulticastRecvAddr returns as Option that set an IPv4 multicast address
+// where to receive packets.  An address which is set by
+// SetMulticastRecvAddrIPv4() is used when this is omitted.
+// This option works with Advertise() and Monitor.
+func MulticastRecvAddr(addr string) Option {
+	return optionFunc(func(c *config) error {
+		if _, err := net.ResolveUDPAddr("udp4", addr); err != nil {
+			return err
+		}
+		c.recvAddr = addr
+		return nil
+	})
+}
+
+// MulticastSendAddr returns as Option that set an IPv4 multicast address to
+// send packets.  An address which is set by SetMulticastSendAddrIPv4() is
+// used when this is omitted.
+func MulticastSendAddr(addr string) Option {
+	return optionFunc(func(c *config) error {
+		if _, err := net.ResolveUDPAddr("udp4", addr); err != nil {
+			return err
+		}
+		c.sendAddr = addr
+		return nil
+	})
+}
+
+// Port returns as Option that set an UDP port for SSDP, to receive and to
+// send multicast packets.  Default is 1900.
+func Port(port int) Option {
+	return optionFunc(func(c *config) error {
+		if port < 1 || port > 65535 {
+			return fmt.Errorf("port out of range: %d", port)
+		}
+		c.port = port
+		return nil
+	})
+}
+
+// UseLogger returns as Option that set a logger.  Logger variable is used
+// when this is omitted.
+// Structured messages are written as text, like "message key=value ...".
+func UseLogger(l *log.Logger) Option {
+	return optionFunc(func(c *config) error {
+		c.log = ssdplog.New(l)
+		return nil
+	})
+}
+
+// UseSlog returns as Option that set a structured logger.
+// Messages have attributes: "event", "st", "usn", "from", "interface" and
+// "error".  Messages for each packet are logged at debug level, and
+// failures are logged at warn or error level.
+func UseSlog(l *slog.Logger) Option {
+	return optionFunc(func(c *config) error {
+		if l == nil {
+			c.log = nil
+			return nil
+		}
+		c.log = ssdplog.NewSlog(l.Handler())
+		return nil
+	})
+}
+
+// UseSlogHandler returns as Option that set a handler for structured logs.
+// See UseSlog() for details of messages.
+func UseSlogHandler(h slog.Handler) Option {
+	return optionFunc(func(c *config) error {
+		c.log = ssdplog.NewSlog(h)
+		return nil
+	})
+}
+
+// UseTransport returns as Option that set a Transport to send and receive
+// SSDP messages, instead of UDP multicast.  Options for UDP multicast, like
+// TTL() and UseInterfaces(), are ignored with this.
+func UseTransport(t Transport) Option {
+	return optionFunc(func(c *config) error {
+		c.tr = t
+		return nil
+	})
+}
+
+// ErrorHandler returns as Option that set a handler to be notified errors of
+// Monitor and Advertiser: *ParseError, *UnexpectedMANError,
+// *UnknownNTSError, *ReadError and others.  Errors are logged too.
+// The handler may be called concurrently.
+func ErrorHandler(h func(error)) Option {
+	return optionFunc(func(c *config) error {
+		c.errorHandler = h
+		return nil
+	})
+}
+
+// MonitorWorkers returns as Option that set a number of workers of Monitor
+// to handle received packets.  Default is 4.
+func MonitorWorkers(n int) Option {
+	return optionFunc(func(c *config) error {
+		if n < 0 {
+			return fmt.Errorf("negative workers: %d", n)
+		}
+		c.workers = n
+		return nil
+	})
+}
+
+// MonitorQueue returns as Option that set a size of queue of Monitor for
+// received packets, and a policy when the queue is full.  Default is 256
+// with DropNewest.  With MonitorOrder(), each worker has a queue of the
+// size.
+func MonitorQueue(size int, policy OverflowPolicy) Option {
+	return optionFunc(func(c *config) error {
+		if size < 0 {
+			return fmt.Errorf("negative queue size: %d", size)
+		}
+		c.queue = size
+		c.overflow = policy
+		return nil
+	})
+}
+
+// MonitorOrder returns as Option that set an order of Monitor to deliver
+// messages to handlers.  Default is OrderNone.
+func MonitorOrder(order DeliveryOrder) Option {
+	return optionFunc(func(c *config) error {
+		c.order = order
+		return nil
+	})
+}
+
+// AllowSources returns as Option that make Advertiser and Monitor handle
+// packets only from addresses in networks.  Each network is a CIDR notation
+// like "192.168.0.0/24" or an IP address.
+func AllowSources(networks ...string) Option {
+	return optionFunc(func(c *config) error {
+		nets, err := parseNets(networks)
+		if err != nil {
+			return err
+		}
+		c.allowNets = append(c.allowNets, nets...)
+		return nil
+	})
+}
+
+// DenySources returns as Option that make Advertiser and Monitor ignore
+// packets from addresses in networks.  It precedes AllowSources().  Each
+// network is a CIDR notation or an IP address.
+func DenySources(networks ...string) Option {
+	return optionFunc(func(c *config) error {
+		nets, err := parseNets(networks)
+		if err != nil {
+			return err
+		}
+		c.denyNets = append(c.denyNets, nets...)
+		return nil
+	})
+}
+
+// SourceInterfaces returns as Option that make Advertiser and Monitor handle
+// packets only which are received on interfaces with the names.
+func SourceInterfaces(names ...string) Option {
+	return optionFunc(func(c *config) error {
+		c.interfaces = append(c.interfaces, names...)
+		return nil
+	})
+}
+
 // AdvertiseHost returns as Option that add HOST header to response for
 // M-SEARCH requests.
 // This option works with Advertise() function only.
@@ -75,3 +393,224 @@ func AdvertiseHost() Option {
 		return nil
 	})
 }
+
+// ResponseRateLimit returns as Option that limit responses of Advertiser
+// for each source IP address, to rate per second with burst.  Responses over
+// the limit are suppressed.
+// This option works with Advertise() function only.
+func ResponseRateLimit(rate float64, burst int) Option {
+	return optionFunc(func(c *config) error {
+		l, err := newRateLimit(rate, burst)
+		if err != nil {
+			return err
+		}
+		c.perSourceLimit = l
+		return nil
+	})
+}
+
+// GlobalResponseRateLimit returns as Option that limit all responses of
+// Advertiser to rate per second with burst.  Responses over the limit are
+// suppressed.
+// This option works with Advertise() function only.
+func GlobalResponseRateLimit(rate float64, burst int) Option {
+	return optionFunc(func(c *config) error {
+		l, err := newRateLimit(rate, burst)
+		if err != nil {
+			return err
+		}
+		c.globalLimit = l
+		return nil
+	})
+}
+
+func newRateLimit(rate float64, burst int) (rateLimit, error) {
+	if rate <= 0 {
+		return rateLimit{}, fmt.Errorf("rate should be positive: %g", rate)
+	}
+	if burst < 1 {
+		return rateLimit{}, fmt.Errorf("burst should be positive: %d", burst)
+	}
+	return rateLimit{rate: rate, burst: burst}, nil
+}
+
+// MaxPendingResponses returns as Option that limit a number of responses
+// which wait to be sent after delays by MX.  Responses over the limit are
+// dropped.  Default is 1024.
+// This option works with Advertise() function only.
+func MaxPendingResponses(n int) Option {
+	return optionFunc(func(c *config) error {
+		if n < 1 {
+			return fmt.Errorf("max pending responses should be positive: %d", n)
+		}
+		c.maxPending = n
+		return nil
+	})
+}
+
+// LocalSourcesOnly returns as Option that make Advertiser ignore M-SEARCH
+// from addresses which are not private, loopback nor link-local, and not in
+// networks of the interface which received it.
+// This option works with Advertise() function only.
+func LocalSourcesOnly() Option {
+	return optionFunc(func(c *config) error {
+		c.localOnly = true
+		return nil
+	})
+}
+
+// UseAdmissionPolicy returns as Option that set a policy to decide whether
+// Advertiser responds to a M-SEARCH or not.
+// This option works with Advertise() function only.
+func UseAdmissionPolicy(p AdmissionPolicy) Option {
+	return optionFunc(func(c *config) error {
+		c.admission = p
+		return nil
+	})
+}
+
+// BootID returns as Option that add BOOTID.UPNP.ORG header to messages.
+func BootID(id int) Option {
+	return optionFunc(func(c *config) error {
+		if id < 0 || id > maxBootID {
+			return fmt.Errorf("BOOTID out of range: %d", id)
+		}
+		c.bootID = id
+		c.hasBootID = true
+		return nil
+	})
+}
+
+// BootIDFrom returns as Option that add BOOTID.UPNP.ORG header to messages,
+// with a value which is persisted by the store.
+// Advertise() function increments and stores the value on each call.
+// Other functions use a stored value as is.
+func BootIDFrom(store BootIDStore) Option {
+	return optionFunc(func(c *config) error {
+		c.bootIDStore = store
+		return nil
+	})
+}
+
+// ConfigID returns as Option that add CONFIGID.UPNP.ORG header to messages.
+func ConfigID(id int) Option {
+	return optionFunc(func(c *config) error {
+		if id < 0 || id > maxConfigID {
+			return fmt.Errorf("CONFIGID out of range: %d", id)
+		}
+		c.configID = id
+		c.hasConfigID = true
+		return nil
+	})
+}
+
+// SearchPort returns as Option that add SEARCHPORT.UPNP.ORG header to
+// messages.  It is required when a device listens unicast M-SEARCH on other
+// than port 1900.
+// Advertiser listens unicast M-SEARCH on the port too, and fails to start
+// when the port is not available.  Announce functions only add the header,
+// so the port should be served by an Advertiser.
+func SearchPort(port int) Option {
+	return optionFunc(func(c *config) error {
+		if port < minSearchPort || port > maxSearchPort {
+			return fmt.Errorf("SEARCHPORT out of range: %d", port)
+		}
+		c.searchPort = port
+		return nil
+	})
+}
+
+// AutoAlive returns as Option that Advertiser announces ssdp:alive messages
+// by itself.  It sends an initial burst of alive messages, refreshes them
+// periodically in random intervals which is less than a half of max-age, and
+// sends byebye messages on Close().  Refreshes and byebye on Close() are
+// skipped after Bye(), until Alive() is called.
+// This option works with Advertise(), AdvertiseDevice() and NewServer()
+// functions only.
+func AutoAlive() Option {
+	return optionFunc(func(c *config) error {
+		c.autoAlive = true
+		return nil
+	})
+}
+
+// AliveInterval returns as Option that enables AutoAlive() with an interval
+// to refresh alive messages.  Actual intervals are randomly spread between
+// a half and whole of d.
+func AliveInterval(d time.Duration) Option {
+	return optionFunc(func(c *config) error {
+		if d <= 0 {
+			return fmt.Errorf("alive interval should be positive: %s", d)
+		}
+		c.autoAlive = true
+		c.aliveInterval = d
+		return nil
+	})
+}
+
+// AliveRepeat returns as Option that set a number of times to send alive
+// messages on start and byebye messages on close, for AutoAlive().
+func AliveRepeat(n int) Option {
+	return optionFunc(func(c *config) error {
+		if n <= 0 {
+			return fmt.Errorf("alive repeat should be positive: %d", n)
+		}
+		c.aliveRepeat = n
+		return nil
+	})
+}
+
+// AliveSpacing returns as Option that set an interval between repeated alive
+// or byebye messages, for AutoAlive().
+func AliveSpacing(d time.Duration) Option {
+	return optionFunc(func(c *config) error {
+		if d <= 0 {
+			return fmt.Errorf("alive spacing should be positive: %s", d)
+		}
+		c.aliveSpacing = d
+		return nil
+	})
+}
+
+// AcceptAnyST returns as Option that Search() accepts responses which have
+// ST not matched with the search type.  It is a workaround for buggy
+// devices.
+// This option works with Search(), SearchContext() and SearchFunc()
+// functions only.
+func AcceptAnyST() Option {
+	return optionFunc(func(c *config) error {
+		c.acceptAnyST = true
+		return nil
+	})
+}
+
+// SearchTypes returns as Option that Search() queries additional search types
+// in the same call on the same socket.  Service.Query tells which query a
+// service answered.
+// This option works with Search(), SearchContext() and SearchFunc()
+// functions only.
+func SearchTypes(types ...string) Option {
+	return optionFunc(func(c *config) error {
+		c.searchTypes = append(c.searchTypes, types...)
+		return nil
+	})
+}
+
+// Retransmit returns as Option that Search() retransmits M-SEARCH n times
+// with spacing, to recover lost packets.  Retransmissions are done only in
+// waitSec of Search(), so the overall wait is not extended.
+// This option works with Search(), SearchContext() and SearchFunc()
+// functions only.
+func Retransmit(n int, spacing time.Duration) Option {
+	return optionFunc(func(c *config) error {
+		if n < 0 {
+			return fmt.Errorf("retransmit count should not be negative: %d", n)
+		}
+		if spacing <= 0 {
+			return fmt.Errorf("retransmit spacing should be positive: %s", spacing)
+		}
+		c.retransmit = n
+		c.retransmitSpacing = spacing
+		return nil
+	})
+}
@@ -0,0 +1,116 @@
+package ssdp
+
+import (
+	"bytes"
+	"encoding/json"
+	"log"
+	"log/slog"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestPort(t *testing.T) {
+	for _, port := range []int{0, -1, 65536} {
+		if _, err := opts2config([]Option{Port(port)}); err == nil {
+			t.Errorf("port %d should be rejected", port)
+		}
+	}
+	cfg, err := opts2config([]Option{Port(19000)})
+	if err != nil {
+		t.Fatalf("failed to apply options: %s", err)
+	}
+	r := cfg.multicastConfig.recvAddrResolver()
+	if !strings.HasSuffix(r.Addr, ":19000") || !strings.HasSuffix(r.AddrIPv6, ":19000") {
+		t.Errorf("port is not applied: %q, %q", r.Addr, r.AddrIPv6)
+	}
+}
+
+func TestMulticastAddrs(t *testing.T) {
+	if _, err := opts2config([]Option{MulticastRecvAddr("invalid")}); err == nil {
+		t.Error("invalid receive address should be rejected")
+	}
+	if _, err := opts2config([]Option{MulticastSendAddr("invalid")}); err == nil {
+		t.Error("invalid send address should be rejected")
+	}
+}
+
+type syncBuffer struct {
+	mu sync.Mutex
+	b  bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.b.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.b.String()
+}
+
+func TestInstancesIsolated(t *testing.T) {
+	var logs [2]syncBuffer
+	for i, port := range []int{19001, 19002} {
+		usn := []string{"usn:option+isolated+1", "usn:option+isolated+2"}[i]
+		a, err := Advertise("test:option+isolated", usn, "location:option+isolated", "server:option+isolated", 600,
+			Port(port), UseLogger(log.New(&logs[i], "", 0)))
+		if err != nil {
+			t.Fatalf("failed to Advertise: %s", err)
+		}
+		t.Cleanup(func() {
+			a.Close()
+		})
+	}
+
+	srvs, err := Search("test:option+isolated", 1, "", Port(19001))
+	if err != nil {
+		t.Fatalf("failed to Search: %s", err)
+	}
+	if len(srvs) != 1 || srvs[0].USN != "usn:option+isolated+1" {
+		t.Errorf("unexpected services: %+v", srvs)
+	}
+
+	if s := logs[0].String(); !strings.Contains(s, "received M-SEARCH") {
+		t.Errorf("logger #1 should log M-SEARCH: %q", s)
+	}
+	if s := logs[1].String(); strings.Contains(s, "received M-SEARCH") {
+		t.Errorf("logger #2 should not log M-SEARCH: %q", s)
+	}
+}
+
+func TestUseSlog(t *testing.T) {
+	var b syncBuffer
+	l := slog.New(slog.NewJSONHandler(&b, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	a, err := Advertise("test:option+slog", "usn:option+slog", "location:option+slog", "server:option+slog", 600,
+		Port(19003), UseSlog(l))
+	if err != nil {
+		t.Fatalf("failed to Advertise: %s", err)
+	}
+	t.Cleanup(func() {
+		a.Close()
+	})
+	if _, err := Search("test:option+slog", 1, "", Port(19003)); err != nil {
+		t.Fatalf("failed to Search: %s", err)
+	}
+
+	var found bool
+	for _, line := range strings.Split(strings.TrimSpace(b.String()), "\n") {
+		var v map[string]any
+		if err := json.Unmarshal([]byte(line), &v); err != nil {
+			t.Fatalf("invalid JSON log: %q", line)
+		}
+		if v["msg"] == "received M-SEARCH" {
+			found = true
+			if v["level"] != "DEBUG" || v["event"] != "search" || v["st"] != "test:option+slog" || v["from"] == "" {
+				t.Errorf("unexpected attributes: %v", v)
+			}
+		}
+	}
+	if !found {
+		t.Errorf("M-SEARCH is not logged: %q", b.String())
+	}
+}
@@ -0,0 +1,183 @@
+package ssdp
+
+import (
+	"hash/fnv"
+	"sync"
+	"sync/atomic"
+)
+
+// OverflowPolicy is a policy of Monitor for received packets when its queue
+// is full.
+type OverflowPolicy int
+
+const (
+	// DropNewest drops a received packet when the queue is full.
+	DropNewest OverflowPolicy = iota
+
+	// DropOldest drops the oldest packet in the queue to enqueue a received
+	// packet.
+	DropOldest
+
+	// Block waits for the queue to have room.  Packets may be dropped by
+	// the system while waiting.
+	Block
+)
+
+// DeliveryOrder is an order of Monitor to deliver messages to handlers.
+type DeliveryOrder int
+
+const (
+	// OrderNone delivers messages in any order, concurrently.
+	OrderNone DeliveryOrder = iota
+
+	// OrderBySource delivers messages from a same sender IP address in the
+	// received order.
+	OrderBySource
+
+	// OrderByUSN delivers messages which have a same USN in the received
+	// order.
+	OrderByUSN
+)
+
+// Default values of worker pool for Monitor.
+const (
+	defaultMonitorWorkers = 4
+	defaultMonitorQueue   = 256
+)
+
+type monitorConfig struct {
+	workers  int
+	queue    int
+	overflow OverflowPolicy
+	order    DeliveryOrder
+}
+
+func (c monitorConfig) numWorkers() int {
+	if c.workers > 0 {
+		return c.workers
+	}
+	return defaultMonitorWorkers
+}
+
+func (c monitorConfig) queueSize() int {
+	if c.queue > 0 {
+		return c.queue
+	}
+	return defaultMonitorQueue
+}
+
+// MonitorStats is statistics of received packets by Monitor.
+type MonitorStats struct {
+	// Received is a number of received packets.
+	Received uint64
+
+	// Dropped is a number of packets which were dropped because the queue
+	// was full.
+	Dropped uint64
+
+	// Filtered is a number of packets which were ignored by AllowSources(),
+	// DenySources() or SourceInterfaces().  They are not counted as
+	// received.
+	Filtered uint64
+}
+
+// job is a received packet to be handled by workers.
+type job struct {
+	src Source
+	raw []byte
+}
+
+// workerPool handles jobs by bounded workers with bounded queues.  When
+// ordered, each worker has its own queue, and jobs which have a same key are
+// handled by a same worker in order.  Otherwise all workers share a queue.
+type workerPool struct {
+	queues   []chan job
+	overflow OverflowPolicy
+	done     <-chan struct{}
+	wg       sync.WaitGroup
+
+	received atomic.Uint64
+	dropped  atomic.Uint64
+}
+
+func newWorkerPool(cfg monitorConfig, done <-chan struct{}, fn func(job)) *workerPool {
+	n, size := cfg.numWorkers(), cfg.queueSize()
+	p := &workerPool{overflow: cfg.overflow, done: done}
+	if cfg.order == OrderNone {
+		p.queues = []chan job{make(chan job, size)}
+	} else {
+		p.queues = make([]chan job, n)
+		for i := range p.queues {
+			p.queues[i] = make(chan job, size)
+		}
+	}
+	for i := range n {
+		q := p.queues[i%len(p.queues)]
+		p.wg.Add(1)
+		go func() {
+			defer p.wg.Done()
+			for j := range q {
+				fn(j)
+			}
+		}()
+	}
+	return p
+}
+
+// push enqueues a job to a queue for the key.
+func (p *workerPool) push(key string, j job) {
+	p.received.Add(1)
+	q := p.queues[0]
+	if len(p.queues) > 1 {
+		h := fnv.New32a()
+		h.Write([]byte(key))
+		q = p.queues[h.Sum32()%uint32(len(p.queues))]
+	}
+	switch p.overflow {
+	case Block:
+		select {
+		case q <- j:
+		case <-p.done:
+			p.dropped.Add(1)
+		}
+	case DropOldest:
+		for {
+			select {
+			case q <- j:
+				return
+			default:
+			}
+			select {
+			case <-q:
+				p.dropped.Add(1)
+			default:
+			}
+		}
+	default:
+		select {
+		case q <- j:
+		default:
+			p.dropped.Add(1)
+		}
+	}
+}
+
+// close stops workers after handling queued jobs, without waiting for them.
+// push must not be called after this.
+func (p *workerPool) close() {
+	for _, q := range p.queues {
+		close(q)
+	}
+}
+
+// wait waits for workers to stop.
+func (p *workerPool) wait() {
+	p.wg.Wait()
+}
+
+func (p *workerPool) stats() MonitorStats {
+	return MonitorStats{
+		Received: p.received.Load(),
+		Dropped:  p.dropped.Load(),
+	}
+}
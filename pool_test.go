@@ -0,0 +1,176 @@
+package ssdp
+
+import (
+	"fmt"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+)
+
+// blockedPool creates a pool with a worker which is blocked until release
+// is closed.  The worker takes the first job, then blocks.
+func blockedPool(t *testing.T, cfg monitorConfig) (*workerPool, chan struct{}, *[]string) {
+	t.Helper()
+	var (
+		mu      sync.Mutex
+		handled []string
+		first   = make(chan struct{})
+		release = make(chan struct{})
+		once    sync.Once
+	)
+	p := newWorkerPool(cfg, nil, func(j job) {
+		once.Do(func() {
+			close(first)
+			<-release
+		})
+		mu.Lock()
+		handled = append(handled, string(j.raw))
+		mu.Unlock()
+	})
+	p.push("", job{raw: []byte("0")})
+	<-first
+	return p, release, &handled
+}
+
+func TestWorkerPool_Overflow(t *testing.T) {
+	for _, tc := range []struct {
+		policy OverflowPolicy
+		want   []string
+	}{
+		{DropNewest, []string{"0", "1", "2"}},
+		{DropOldest, []string{"0", "3", "4"}},
+	} {
+		p, release, handled := blockedPool(t, monitorConfig{workers: 1, queue: 2, overflow: tc.policy})
+		for i := 1; i <= 4; i++ {
+			p.push("", job{raw: []byte(fmt.Sprint(i))})
+		}
+		close(release)
+		p.close()
+		p.wait()
+		if !slices.Equal(*handled, tc.want) {
+			t.Errorf("unexpected handled jobs for policy %d: want=%v got=%v", tc.policy, tc.want, *handled)
+		}
+		want := MonitorStats{Received: 5, Dropped: 2}
+		if got := p.stats(); got != want {
+			t.Errorf("unexpected stats for policy %d: want=%+v got=%+v", tc.policy, want, got)
+		}
+	}
+}
+
+func TestWorkerPool_Block(t *testing.T) {
+	p, release, handled := blockedPool(t, monitorConfig{workers: 1, queue: 1, overflow: Block})
+	p.push("", job{raw: []byte("1")})
+	pushed := make(chan struct{})
+	go func() {
+		p.push("", job{raw: []byte("2")})
+		close(pushed)
+	}()
+	select {
+	case <-pushed:
+		t.Fatal("push should be blocked while the queue is full")
+	case <-time.After(50 * time.Millisecond):
+	}
+	close(release)
+	<-pushed
+	p.close()
+	p.wait()
+	if want := []string{"0", "1", "2"}; !slices.Equal(*handled, want) {
+		t.Errorf("unexpected handled jobs: want=%v got=%v", want, *handled)
+	}
+	if got := p.stats().Dropped; got != 0 {
+		t.Errorf("unexpected dropped: %d", got)
+	}
+}
+
+func TestMonitor_OrderByUSN(t *testing.T) {
+	const n = 100
+	var packets [][]byte
+	for i := range n {
+		for _, usn := range []string{"usn:a", "usn:b"} {
+			packets = append(packets, []byte(fmt.Sprintf("NOTIFY * HTTP/1.1\r\n"+
+				"HOST: 239.255.255.250:1900\r\nNT: test:order\r\nNTS: ssdp:alive\r\n"+
+				"USN: %s\r\nLOCATION: %d\r\nCACHE-CONTROL: max-age=600\r\n\r\n", usn, i)))
+		}
+	}
+	var (
+		mu   sync.Mutex
+		got  = map[string][]string{}
+		done = make(chan struct{})
+	)
+	m := &Monitor{
+		Alive: func(am *AliveMessage) {
+			mu.Lock()
+			defer mu.Unlock()
+			got[am.USN] = append(got[am.USN], am.Location)
+			if len(got["usn:a"])+len(got["usn:b"]) == len(packets) {
+				close(done)
+			}
+		},
+		Options: []Option{
+			UseTransport(&testTransport{packets: packets}),
+			MonitorWorkers(8),
+			MonitorQueue(len(packets), DropNewest),
+			MonitorOrder(OrderByUSN),
+		},
+	}
+	if err := m.Start(); err != nil {
+		t.Fatalf("failed to start Monitor: %s", err)
+	}
+	defer m.Close()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatalf("messages are not delivered: %+v", m.Stats())
+	}
+	var want []string
+	for i := range n {
+		want = append(want, fmt.Sprint(i))
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	for _, usn := range []string{"usn:a", "usn:b"} {
+		if !slices.Equal(got[usn], want) {
+			t.Errorf("messages for %s are not in order: %v", usn, got[usn])
+		}
+	}
+	if st := m.Stats(); st.Received != uint64(len(packets)) || st.Dropped != 0 {
+		t.Errorf("unexpected stats: %+v", st)
+	}
+}
+
+func TestMonitor_CloseInHandler(t *testing.T) {
+	alive := (&Notify{Host: "239.255.255.250:1900", NT: "test:close", NTS: NTSAlive, USN: "uuid:close"}).Marshal()
+	closed := make(chan struct{})
+	var once sync.Once
+	var m *Monitor
+	m = &Monitor{
+		Alive: func(*AliveMessage) {
+			once.Do(func() {
+				m.Close()
+				close(closed)
+			})
+		},
+		Options: []Option{UseTransport(&testTransport{packets: [][]byte{alive, alive, alive}})},
+	}
+	if err := m.Start(); err != nil {
+		t.Fatalf("failed to start: %s", err)
+	}
+	select {
+	case <-closed:
+	case <-time.After(2 * time.Second):
+		t.Fatal("Close in a handler is blocked")
+	}
+	// Wait from outside after that waits workers, and returns.
+	done := make(chan struct{})
+	go func() {
+		m.Close()
+		m.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("Wait after Close in a handler is blocked")
+	}
+}
@@ -0,0 +1,137 @@
+package ssdp
+
+import (
+	"net"
+	"sync"
+	"time"
+)
+
+// maxLimitedSources is the maximum number of sources which rateLimiter
+// tracks.  Idle sources are forgotten when it is exceeded, to bound memory
+// for floods from spoofed addresses.
+const maxLimitedSources = 4096
+
+// tokenBucket is a token bucket, which has burst tokens at most and gains
+// rate tokens per second.
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// refill adds tokens for elapsed time, and returns a number of available
+// tokens.
+func (b *tokenBucket) refill(now time.Time, l rateLimit) int {
+	if b.last.IsZero() {
+		b.tokens = float64(l.burst)
+	} else if d := now.Sub(b.last); d > 0 {
+		b.tokens = min(b.tokens+d.Seconds()*l.rate, float64(l.burst))
+	}
+	b.last = now
+	return int(b.tokens)
+}
+
+// full checks the bucket will be full at now.
+func (b *tokenBucket) full(now time.Time, l rateLimit) bool {
+	return b.estimate(now, l) >= float64(l.burst)
+}
+
+// estimate returns a number of tokens at now, without refilling.
+func (b *tokenBucket) estimate(now time.Time, l rateLimit) float64 {
+	return b.tokens + now.Sub(b.last).Seconds()*l.rate
+}
+
+type rateLimit struct {
+	rate  float64
+	burst int
+}
+
+func (l rateLimit) enabled() bool {
+	return l.rate > 0
+}
+
+// rateLimiter limits responses per source and in total.
+type rateLimiter struct {
+	perSource rateLimit
+	global    rateLimit
+	now       func() time.Time
+
+	mu      sync.Mutex
+	sources map[string]*tokenBucket
+	all     tokenBucket
+}
+
+func newRateLimiter(perSource, global rateLimit) *rateLimiter {
+	if !perSource.enabled() && !global.enabled() {
+		return nil
+	}
+	return &rateLimiter{
+		perSource: perSource,
+		global:    global,
+		now:       time.Now,
+		sources:   map[string]*tokenBucket{},
+	}
+}
+
+// allow returns a number of responses which can be sent to from, up to n.
+// A nil rateLimiter allows all.
+func (l *rateLimiter) allow(from net.Addr, n int) int {
+	if l == nil {
+		return n
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := l.now()
+	var b *tokenBucket
+	if l.perSource.enabled() {
+		key := sourceKey(from)
+		var ok bool
+		b, ok = l.sources[key]
+		if !ok {
+			l.forgetIdle(now)
+			b = &tokenBucket{}
+			l.sources[key] = b
+		}
+		n = min(n, b.refill(now, l.perSource))
+	}
+	if l.global.enabled() {
+		n = min(n, l.all.refill(now, l.global))
+		l.all.tokens -= float64(n)
+	}
+	if b != nil {
+		b.tokens -= float64(n)
+	}
+	return n
+}
+
+// forgetIdle removes sources which have full buckets, when too many sources
+// are tracked.  When it is not enough, a source which has the most tokens is
+// removed, so throttled sources are kept throttled.
+func (l *rateLimiter) forgetIdle(now time.Time) {
+	if len(l.sources) < maxLimitedSources {
+		return
+	}
+	var (
+		fullest string
+		most    = -1.0
+	)
+	for k, b := range l.sources {
+		if b.full(now, l.perSource) {
+			delete(l.sources, k)
+			continue
+		}
+		if t := b.estimate(now, l.perSource); t > most {
+			fullest, most = k, t
+		}
+	}
+	if len(l.sources) >= maxLimitedSources {
+		delete(l.sources, fullest)
+	}
+}
+
+// sourceKey returns a key of a source to limit, its IP address.
+func sourceKey(addr net.Addr) string {
+	if a, ok := addr.(*net.UDPAddr); ok {
+		return a.IP.String()
+	}
+	return addr.String()
+}
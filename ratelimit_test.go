@@ -0,0 +1,180 @@
+package ssdp
+
+import (
+	"net"
+	"testing"
+	"time"
+)
+
+func TestRateLimiter(t *testing.T) {
+	clock := &testClock{now: time.Unix(1700000000, 0)}
+	l := newRateLimiter(rateLimit{rate: 1, burst: 2}, rateLimit{rate: 10, burst: 3})
+	l.now = clock.Now
+	a := &net.UDPAddr{IP: net.IPv4(192, 168, 0, 1), Port: 1900}
+	a2 := &net.UDPAddr{IP: net.IPv4(192, 168, 0, 1), Port: 50000}
+	b := &net.UDPAddr{IP: net.IPv4(192, 168, 0, 2), Port: 1900}
+
+	for i, tc := range []struct {
+		d    time.Duration
+		from net.Addr
+		n    int
+		want int
+	}{
+		// per source burst.
+		{0, a, 3, 2},
+		// same IP address with another port shares the limit.
+		{0, a2, 1, 0},
+		// global burst.
+		{0, b, 2, 1},
+		{0, b, 1, 0},
+		// refilled.
+		{time.Second, a, 2, 1},
+		// b keeps a token which is not taken by the global limit.
+		{0, b, 3, 2},
+	} {
+		clock.Advance(tc.d)
+		if got := l.allow(tc.from, tc.n); got != tc.want {
+			t.Errorf("#%d unexpected allowed: want=%d got=%d", i, tc.want, got)
+		}
+	}
+}
+
+func TestRateLimiter_Nil(t *testing.T) {
+	l := newRateLimiter(rateLimit{}, rateLimit{})
+	if l != nil {
+		t.Fatalf("rateLimiter should be nil without limits: %+v", l)
+	}
+	if got := l.allow(testFrom, 5); got != 5 {
+		t.Errorf("nil rateLimiter should allow all: got=%d", got)
+	}
+}
+
+func TestRateLimiter_ForgetIdle(t *testing.T) {
+	clock := &testClock{now: time.Unix(1700000000, 0)}
+	l := newRateLimiter(rateLimit{rate: 1, burst: 2}, rateLimit{})
+	l.now = clock.Now
+	throttled := &net.UDPAddr{IP: net.IPv4(192, 168, 0, 1)}
+	if got := l.allow(throttled, 3); got != 2 {
+		t.Fatalf("unexpected allowed: want=2 got=%d", got)
+	}
+	for i := range maxLimitedSources + 10 {
+		ip := net.IPv4(10, byte(i>>16), byte(i>>8), byte(i))
+		l.allow(&net.UDPAddr{IP: ip}, 1)
+	}
+	if n := len(l.sources); n > maxLimitedSources {
+		t.Errorf("too many sources are tracked: %d", n)
+	}
+	if got := l.allow(throttled, 1); got != 0 {
+		t.Errorf("throttled source should be kept throttled: allowed=%d", got)
+	}
+}
+
+func newSearchPacket(st string) []byte {
+	return (&MSearch{Host: "192.0.2.100:1900", MAN: manDiscover, ST: st}).Marshal()
+}
+
+func waitAdvertiserStats(t *testing.T, a *Advertiser, total uint64) AdvertiserStats {
+	t.Helper()
+	var st AdvertiserStats
+	for range 100 {
+		st = a.Stats()
+		if st.Responded+st.Suppressed+st.Rejected+st.Filtered+st.Dropped >= total {
+			return st
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("M-SEARCH are not handled: %+v", st)
+	return st
+}
+
+func TestAdvertise_ResponseRateLimit(t *testing.T) {
+	var packets [][]byte
+	for range 5 {
+		packets = append(packets, newSearchPacket(All))
+	}
+	a, err := Advertise("test:ratelimit", "usn:ratelimit", "location:ratelimit", "", 600,
+		UseTransport(&testTransport{packets: packets}),
+		ResponseRateLimit(0.001, 2))
+	if err != nil {
+		t.Fatalf("failed to advertise: %s", err)
+	}
+	defer a.Close()
+	st := waitAdvertiserStats(t, a, 5)
+	if want := (AdvertiserStats{Responded: 2, Suppressed: 3}); st != want {
+		t.Errorf("unexpected stats: want=%+v got=%+v", want, st)
+	}
+}
+
+func TestAdvertise_RateLimitInvalidMX(t *testing.T) {
+	invalid := []byte("M-SEARCH * HTTP/1.1\r\n" +
+		"HOST: 239.255.255.250:1900\r\n" +
+		"MAN: \"ssdp:discover\"\r\n" +
+		"MX: foo\r\n" +
+		"ST: ssdp:all\r\n" +
+		"\r\n")
+	packets := [][]byte{invalid, invalid, invalid, newSearchPacket(All)}
+	a, err := Advertise("test:invalidmx", "usn:invalidmx", "location:invalidmx", "", 600,
+		UseTransport(&testTransport{packets: packets}),
+		GlobalResponseRateLimit(0.001, 1))
+	if err != nil {
+		t.Fatalf("failed to advertise: %s", err)
+	}
+	defer a.Close()
+	// requests with invalid MX don't consume tokens.
+	st := waitAdvertiserStats(t, a, 1)
+	if want := (AdvertiserStats{Responded: 1}); st != want {
+		t.Errorf("unexpected stats: want=%+v got=%+v", want, st)
+	}
+}
+
+func TestAdvertise_Admission(t *testing.T) {
+	for i, tc := range []struct {
+		opt  Option
+		want AdvertiserStats
+	}{
+		// testFrom is not a private address.
+		{LocalSourcesOnly(), AdvertiserStats{Rejected: 2}},
+		{UseAdmissionPolicy(AdmissionPolicyFunc(func(src Source, req *MSearch) bool {
+			return req.ST != All
+		})), AdvertiserStats{Responded: 1, Rejected: 1}},
+	} {
+		packets := [][]byte{newSearchPacket(All), newSearchPacket("test:admission")}
+		a, err := Advertise("test:admission", "usn:admission", "location:admission", "", 600,
+			UseTransport(&testTransport{packets: packets}), tc.opt)
+		if err != nil {
+			t.Fatalf("#%d failed to advertise: %s", i, err)
+		}
+		st := waitAdvertiserStats(t, a, 2)
+		a.Close()
+		if st != tc.want {
+			t.Errorf("#%d unexpected stats: want=%+v got=%+v", i, tc.want, st)
+		}
+	}
+}
+
+func TestLocalSourcePolicy(t *testing.T) {
+	ifi := &net.Interface{Index: 1, Name: "test0"}
+	p := localSourcePolicy{addrsOf: func(*net.Interface) ([]net.Addr, error) {
+		return []net.Addr{&net.IPNet{IP: net.ParseIP("203.0.113.1"), Mask: net.CIDRMask(24, 32)}}, nil
+	}}
+	for i, tc := range []struct {
+		ip   string
+		ifi  *net.Interface
+		want bool
+	}{
+		{"192.168.1.10", nil, true},
+		{"10.0.0.1", nil, true},
+		{"127.0.0.1", nil, true},
+		{"fe80::1", nil, true},
+		{"fd00::1", nil, true},
+		{"198.51.100.1", nil, false},
+		{"198.51.100.1", ifi, false},
+		{"203.0.113.50", ifi, true},
+		{"203.0.113.50", nil, false},
+	} {
+		src := Source{From: &net.UDPAddr{IP: net.ParseIP(tc.ip), Port: 1900}, Interface: tc.ifi}
+		if got := p.Admit(src, nil); got != tc.want {
+			t.Errorf("#%d unexpected admission for %s: want=%t got=%t", i, tc.ip, tc.want, got)
+		}
+	}
+}
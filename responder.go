@@ -0,0 +1,124 @@
+package ssdp
+
+import (
+	"container/heap"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// defaultPendingResponses is a default limit of responses which wait to be
+// sent after delays.
+const defaultPendingResponses = 1024
+
+// response is responses to a M-SEARCH, which are sent at a time.
+type response struct {
+	at   time.Time
+	conn TransportConn
+	to   net.Addr
+	ifi  *net.Interface
+	msgs [][]byte
+}
+
+// responseQueue is a min-heap of responses ordered by time to send.
+type responseQueue []*response
+
+func (q responseQueue) Len() int           { return len(q) }
+func (q responseQueue) Less(i, j int) bool { return q[i].at.Before(q[j].at) }
+func (q responseQueue) Swap(i, j int)      { q[i], q[j] = q[j], q[i] }
+
+func (q *responseQueue) Push(x any) {
+	*q = append(*q, x.(*response))
+}
+
+func (q *responseQueue) Pop() any {
+	old := *q
+	n := len(old) - 1
+	r := old[n]
+	old[n] = nil
+	*q = old[:n]
+	return r
+}
+
+// responder sends delayed responses in a goroutine with a timer.  Responses
+// over the limit of pending are dropped.
+type responder struct {
+	max  int
+	send func(*response)
+	done <-chan struct{}
+
+	mu      sync.Mutex
+	queue   responseQueue
+	pending int
+	wake    chan struct{}
+
+	dropped atomic.Uint64
+}
+
+func newResponder(max int, done <-chan struct{}, send func(*response)) *responder {
+	if max <= 0 {
+		max = defaultPendingResponses
+	}
+	return &responder{
+		max:  max,
+		send: send,
+		done: done,
+		wake: make(chan struct{}, 1),
+	}
+}
+
+// schedule queues r to be sent.  This returns false when r is dropped.
+func (p *responder) schedule(r *response) bool {
+	p.mu.Lock()
+	if p.pending+len(r.msgs) > p.max {
+		p.mu.Unlock()
+		p.dropped.Add(uint64(len(r.msgs)))
+		return false
+	}
+	heap.Push(&p.queue, r)
+	p.pending += len(r.msgs)
+	p.mu.Unlock()
+	select {
+	case p.wake <- struct{}{}:
+	default:
+	}
+	return true
+}
+
+// run sends responses on time until done is closed.
+func (p *responder) run() {
+	t := time.NewTimer(0)
+	defer t.Stop()
+	for {
+		due, next := p.popDue(time.Now())
+		for _, r := range due {
+			p.send(r)
+		}
+		if !next.IsZero() {
+			t.Reset(time.Until(next))
+		}
+		select {
+		case <-p.done:
+			return
+		case <-p.wake:
+		case <-t.C:
+		}
+	}
+}
+
+// popDue removes responses which should be sent at now, and returns them
+// with a time to send the next.
+func (p *responder) popDue(now time.Time) (due []*response, next time.Time) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for len(p.queue) > 0 && !p.queue[0].at.After(now) {
+		r := heap.Pop(&p.queue).(*response)
+		p.pending -= len(r.msgs)
+		due = append(due, r)
+	}
+	if len(p.queue) > 0 {
+		next = p.queue[0].at
+	}
+	return due, next
+}
@@ -0,0 +1,67 @@
+package ssdp
+
+import (
+	"fmt"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestResponder(t *testing.T) {
+	var (
+		mu   sync.Mutex
+		sent []string
+		all  = make(chan struct{})
+	)
+	done := make(chan struct{})
+	p := newResponder(3, done, func(r *response) {
+		mu.Lock()
+		defer mu.Unlock()
+		sent = append(sent, string(r.msgs[0]))
+		if len(sent) == 3 {
+			close(all)
+		}
+	})
+	go p.run()
+	defer close(done)
+
+	now := time.Now()
+	for i, d := range []int{60, 20, 40, 10} {
+		r := &response{at: now.Add(time.Duration(d) * time.Millisecond), msgs: [][]byte{[]byte(fmt.Sprint(d))}}
+		if got, want := p.schedule(r), i < 3; got != want {
+			t.Errorf("#%d unexpected result of schedule: want=%t got=%t", i, want, got)
+		}
+	}
+	select {
+	case <-all:
+	case <-time.After(time.Second):
+		t.Fatal("responses are not sent")
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if want := []string{"20", "40", "60"}; !slices.Equal(sent, want) {
+		t.Errorf("unexpected order of responses: want=%v got=%v", want, sent)
+	}
+	if got := p.dropped.Load(); got != 1 {
+		t.Errorf("unexpected dropped: want=1 got=%d", got)
+	}
+}
+
+func TestAdvertise_MaxPendingResponses(t *testing.T) {
+	var packets [][]byte
+	for range 5 {
+		packets = append(packets, (&MSearch{Host: "239.255.255.250:1900", MAN: manDiscover, MX: 3, ST: All}).Marshal())
+	}
+	a, err := Advertise("test:pending", "usn:pending", "location:pending", "", 600,
+		UseTransport(&testTransport{packets: packets}),
+		MaxPendingResponses(2))
+	if err != nil {
+		t.Fatalf("failed to advertise: %s", err)
+	}
+	defer a.Close()
+	st := waitAdvertiserStats(t, a, 5)
+	if want := (AdvertiserStats{Responded: 2, Dropped: 3}); st != want {
+		t.Errorf("unexpected stats: want=%+v got=%+v", want, st)
+	}
+}
@@ -0,0 +1,119 @@
+package ssdp
+
+import (
+	"math/rand/v2"
+	"time"
+
+	"github.com/koron/go-ssdp/internal/ssdplog"
+)
+
+// Default values for scheduled announcements.
+const (
+	defaultAliveRepeat  = 3
+	defaultAliveSpacing = 100 * time.Millisecond
+	defaultMaxAge       = 1800
+)
+
+// scheduleConfig is a configuration for announcements scheduled by
+// Advertiser.
+type scheduleConfig struct {
+	autoAlive     bool
+	aliveInterval time.Duration
+	aliveRepeat   int
+	aliveSpacing  time.Duration
+}
+
+func (c scheduleConfig) repeat() int {
+	if c.aliveRepeat > 0 {
+		return c.aliveRepeat
+	}
+	return defaultAliveRepeat
+}
+
+func (c scheduleConfig) spacing() time.Duration {
+	if c.aliveSpacing > 0 {
+		return c.aliveSpacing
+	}
+	return defaultAliveSpacing
+}
+
+// interval returns an interval to refresh alive, which is randomly spread
+// between half and whole of the base interval.  The base interval is
+// aliveInterval or a half of maxAge.
+func (c scheduleConfig) interval(maxAge int) time.Duration {
+	d := c.aliveInterval
+	if d <= 0 {
+		if maxAge <= 0 {
+			maxAge = defaultMaxAge
+		}
+		d = time.Duration(maxAge) * time.Second / 2
+	}
+	return d/2 + rand.N(d/2+1)
+}
+
+// aliveMain announces an initial burst of alive messages, then refreshes
+// them periodically until Close().  Refreshes are skipped after Bye(), until
+// Alive() is called.
+func (a *Advertiser) aliveMain() {
+	a.burstAlive()
+	for {
+		t := time.NewTimer(a.schedule.interval(a.minMaxAge()))
+		select {
+		case <-t.C:
+			a.refreshAlive()
+		case <-a.done:
+			t.Stop()
+			return
+		}
+	}
+}
+
+// burstAlive sends alive messages repeatedly with spacing.  It is
+// interrupted by Close().
+func (a *Advertiser) burstAlive() {
+	for i := range a.schedule.repeat() {
+		if i > 0 {
+			t := time.NewTimer(a.schedule.spacing())
+			select {
+			case <-t.C:
+			case <-a.done:
+				t.Stop()
+				return
+			}
+		}
+		a.refreshAlive()
+	}
+}
+
+// refreshAlive sends alive messages when alive is announced.
+func (a *Advertiser) refreshAlive() {
+	if !a.announced.Load() {
+		return
+	}
+	if err := a.sendAlive(a.currentTargets()); err != nil {
+		a.log.Error("failed to send alive", ssdplog.KeyEvent, "alive", ssdplog.KeyError, err)
+	}
+}
+
+// burstBye sends byebye messages repeatedly with spacing.
+func (a *Advertiser) burstBye() {
+	for i := range a.schedule.repeat() {
+		if i > 0 {
+			time.Sleep(a.schedule.spacing())
+		}
+		if err := a.sendBye(a.currentTargets()); err != nil {
+			a.log.Error("failed to send bye", ssdplog.KeyEvent, "bye", ssdplog.KeyError, err)
+		}
+	}
+}
+
+// minMaxAge returns the minimum max-age of targets, or 0 when no targets.
+func (a *Advertiser) minMaxAge() int {
+	minAge := 0
+	for i, t := range a.currentTargets() {
+		if i == 0 || t.maxAge < minAge {
+			minAge = t.maxAge
+		}
+	}
+	return minAge
+}
@@ -0,0 +1,105 @@
+package ssdp
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestScheduleConfig_Interval(t *testing.T) {
+	c := scheduleConfig{}
+	for range 100 {
+		if d := c.interval(600); d < 150*time.Second || d > 300*time.Second {
+			t.Fatalf("interval for max-age=600 out of range: %s", d)
+		}
+		if d := c.interval(0); d < 450*time.Second || d > 900*time.Second {
+			t.Fatalf("interval for default max-age out of range: %s", d)
+		}
+	}
+	c = scheduleConfig{aliveInterval: 10 * time.Second}
+	for range 100 {
+		if d := c.interval(600); d < 5*time.Second || d > 10*time.Second {
+			t.Fatalf("interval for 10s out of range: %s", d)
+		}
+	}
+}
+
+func TestAdvertise_AutoAlive(t *testing.T) {
+	var mu sync.Mutex
+	var alives []*AliveMessage
+	var byes []*ByeMessage
+	m := newTestMonitor(t, "test:advertise+autoalive", func(m *AliveMessage) {
+		mu.Lock()
+		alives = append(alives, m)
+		mu.Unlock()
+	}, func(m *ByeMessage) {
+		mu.Lock()
+		byes = append(byes, m)
+		mu.Unlock()
+	}, nil)
+
+	a, err := Advertise("test:advertise+autoalive", "usn:advertise+autoalive", "location:advertise+autoalive", "server:advertise+autoalive", 600,
+		AliveInterval(200*time.Millisecond), AliveRepeat(2), AliveSpacing(10*time.Millisecond))
+	if err != nil {
+		t.Fatalf("failed to Advertise: %s", err)
+	}
+	time.Sleep(600 * time.Millisecond)
+	a.Close()
+	time.Sleep(monitorWait)
+	m.Close()
+
+	mu.Lock()
+	t.Cleanup(mu.Unlock)
+
+	// initial burst (2) and at least one refresh in 600ms.
+	// Each message may be received on multiple interfaces.
+	if len(alives) < 3 {
+		t.Errorf("too few alives: %d", len(alives))
+	}
+	if len(byes) < 2 {
+		t.Errorf("too few byes: %d", len(byes))
+	}
+}
+
+func TestAdvertise_AutoAliveBye(t *testing.T) {
+	var mu sync.Mutex
+	var alives, byes int
+	m := newTestMonitor(t, "test:advertise+autoalivebye", func(*AliveMessage) {
+		mu.Lock()
+		alives++
+		mu.Unlock()
+	}, func(*ByeMessage) {
+		mu.Lock()
+		byes++
+		mu.Unlock()
+	}, nil)
+	defer m.Close()
+	counts := func() (int, int) {
+		mu.Lock()
+		defer mu.Unlock()
+		return alives, byes
+	}
+
+	a, err := Advertise("test:advertise+autoalivebye", "usn:advertise+autoalivebye", "location:advertise+autoalivebye", "server:advertise+autoalivebye", 600,
+		AliveInterval(100*time.Millisecond), AliveRepeat(1))
+	if err != nil {
+		t.Fatalf("failed to Advertise: %s", err)
+	}
+	time.Sleep(20 * time.Millisecond)
+	if err := a.Bye(); err != nil {
+		t.Fatalf("failed to Bye: %s", err)
+	}
+	time.Sleep(monitorWait)
+	alive0, bye0 := counts()
+	if alive0 == 0 || bye0 == 0 {
+		t.Fatalf("messages are not received: alive=%d bye=%d", alive0, bye0)
+	}
+
+	// some ticks pass, then Close.
+	time.Sleep(300 * time.Millisecond)
+	a.Close()
+	time.Sleep(monitorWait)
+	if alive1, bye1 := counts(); alive1 != alive0 || bye1 != bye0 {
+		t.Errorf("messages are sent after Bye: alive=%d->%d bye=%d->%d", alive0, alive1, bye0, bye1)
+	}
+}
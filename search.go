@@ -1,17 +1,16 @@
 package ssdp
 
 import (
-	"bufio"
 	"bytes"
+	"context"
 	"errors"
-	"fmt"
 	"net"
 	"net/http"
 	"regexp"
 	"strconv"
+	"sync"
 	"time"
 
-	"github.com/koron/go-ssdp/internal/multicast"
 	"github.com/koron/go-ssdp/internal/ssdplog"
 )
 
@@ -29,10 +28,53 @@ type Service struct {
 	// Server is a property of "SERVER"
 	Server string
 
+	// From is a sender of the first response for this service.
+	From net.Addr
+
+	// Interface is a local interface which received the first response.
+	// It is nil when unknown.
+	Interface *net.Interface
+
+	// LocalAddr is a destination address of the first response.
+	// It is nil when unknown.
+	LocalAddr net.Addr
+
+	// Query is a search type which this service answered.
+	// It is useful when searching multiple types by SearchTypes() option.
+	Query string
+
+	// Sources lists senders of responses for this service, and interfaces
+	// which received them.  Search merges responses which have same USN
+	// into one Service, so this may have multiple sources.
+	Sources []Source
+
 	rawHeader http.Header
 	maxAge    *int
 }
 
+// Source describes where a message came from.
+type Source struct {
+	// From is a sender of a message.
+	From net.Addr
+
+	// Interface is a local interface which received a message.
+	// It is nil when unknown.
+	Interface *net.Interface
+
+	// LocalAddr is a destination address of a message, it may be a
+	// multicast group address.  It is nil when unknown.
+	LocalAddr net.Addr
+}
+
+// newSource creates a Source from a received packet.
+func newSource(from net.Addr, ifi *net.Interface, dst net.Addr) Source {
+	return Source{
+		From:      from,
+		Interface: ifi,
+		LocalAddr: dst,
+	}
+}
+
 var rxMaxAge = regexp.MustCompile(`\bmax-age\s*=\s*(\d+)\b`)
 
 func extractMaxAge(s string, value int) int {
@@ -59,6 +101,24 @@ func (s *Service) Header() http.Header {
 	return s.rawHeader
 }
 
+// BootID extracts a value of "BOOTID.UPNP.ORG" property.
+// This returns -1 when the property is not available.
+func (s *Service) BootID() int {
+	return headerInt(s.rawHeader, hdrBootID)
+}
+
+// ConfigID extracts a value of "CONFIGID.UPNP.ORG" property.
+// This returns -1 when the property is not available.
+func (s *Service) ConfigID() int {
+	return headerInt(s.rawHeader, hdrConfigID)
+}
+
+// SearchPort extracts a value of "SEARCHPORT.UPNP.ORG" property.
+// This returns -1 when the property is not available.
+func (s *Service) SearchPort() int {
+	return headerInt(s.rawHeader, hdrSearchPort)
+}
+
 const (
 	// All is a search type to search all services and devices.
 	All = "ssdp:all"
@@ -69,89 +129,235 @@ const (
 
 // Search searches services by SSDP.
 func Search(searchType string, waitSec int, localAddr string, opts ...Option) ([]Service, error) {
+	return SearchContext(context.Background(), searchType, waitSec, localAddr, opts...)
+}
+
+// SearchContext searches services by SSDP, with a context.
+// When the context is canceled or its deadline is exceeded before waitSec,
+// this returns services found so far with the context's error.
+// Responses which have same USN are merged into one Service.
+func SearchContext(ctx context.Context, searchType string, waitSec int, localAddr string, opts ...Option) ([]Service, error) {
+	var list []Service
+	index := map[string]int{}
+	err := search(ctx, searchType, waitSec, localAddr, opts, func(srv *Service) bool {
+		if srv.USN != "" {
+			if i, ok := index[srv.USN]; ok {
+				list[i].Sources = append(list[i].Sources, srv.Sources...)
+				return true
+			}
+			index[srv.USN] = len(list)
+		}
+		list = append(list, *srv)
+		return true
+	})
+	return list, err
+}
+
+// SearchFunc searches services by SSDP, and calls fn for each service as
+// soon as it is received.
+// Searching ends when waitSec elapsed, fn returns false, or the context is
+// done.  This returns the context's error for the last case.
+// fn is called once for each USN, and duplicated responses are dropped.
+func SearchFunc(ctx context.Context, searchType string, waitSec int, localAddr string, fn func(*Service) bool, opts ...Option) error {
+	seen := map[string]struct{}{}
+	return search(ctx, searchType, waitSec, localAddr, opts, func(srv *Service) bool {
+		if srv.USN != "" {
+			if _, ok := seen[srv.USN]; ok {
+				return true
+			}
+			seen[srv.USN] = struct{}{}
+		}
+		return fn(srv)
+	})
+}
+
+// search searches services by SSDP, and calls fn for each response.
+func search(ctx context.Context, searchType string, waitSec int, localAddr string, opts []Option, fn func(*Service) bool) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
 	cfg, err := opts2config(opts)
 	if err != nil {
-		return nil, err
+		return err
 	}
 	// dial multicast UDP packet.
-	conn, err := multicast.Listen(&multicast.AddrResolver{Addr: localAddr}, cfg.multicastConfig.options()...)
+	conn, err := cfg.multicastConfig.transport().ListenUnicast(localAddr)
 	if err != nil {
-		return nil, err
+		return err
 	}
 	defer conn.Close()
-	ssdplog.Printf("search on %s", conn.LocalAddr().String())
+	cfg.log.Debug("search", ssdplog.KeyEvent, "search", ssdplog.KeyST, searchType, "local", conn.LocalAddr().String())
+
+	// interrupt waiting responses by closing conn when ctx is done.
+	stop := context.AfterFunc(ctx, func() {
+		conn.Close()
+	})
+	defer stop()
 
 	// send request.
-	addr, err := multicast.SendAddr()
-	if err != nil {
-		return nil, err
-	}
-	msg, err := buildSearch(addr, searchType, waitSec)
-	if err != nil {
-		return nil, err
+	queries := append([]string{searchType}, cfg.searchTypes...)
+	if err := sendSearch(conn, queries, waitSec); err != nil {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return ctxErr
+		}
+		return err
 	}
-	if _, err := conn.WriteTo(multicast.BytesDataProvider(msg), addr); err != nil {
-		return nil, err
+	d := time.Second * time.Duration(waitSec)
+	if cfg.retransmit > 0 {
+		done := make(chan struct{})
+		var wg sync.WaitGroup
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			retransmitSearch(conn, queries, d, cfg.retransmit, cfg.retransmitSpacing, done, cfg.log)
+		}()
+		defer wg.Wait()
+		defer close(done)
 	}
 
 	// wait response.
-	var list []Service
-	h := func(a net.Addr, d []byte) error {
+	h := func(a net.Addr, d []byte, ifi *net.Interface, dst net.Addr) error {
 		srv, err := parseService(d)
 		if err != nil {
-			ssdplog.Printf("invalid search response from %s: %s", a.String(), err)
+			cfg.log.Warn("invalid search response", ssdplog.KeyEvent, "response", ssdplog.KeyFrom, a.String(), ssdplog.KeyError, err)
 			return nil
 		}
-		list = append(list, *srv)
-		ssdplog.Printf("search response from %s: %s", a.String(), srv.USN)
+		srv.Query = matchQuery(queries, srv.Type)
+		if srv.Query == "" {
+			if !cfg.acceptAnyST {
+				cfg.log.Debug("unmatched search response", ssdplog.KeyEvent, "response", ssdplog.KeyFrom, a.String(), ssdplog.KeyST, srv.Type)
+				return nil
+			}
+			srv.Query = searchType
+		}
+		src := newSource(a, ifi, dst)
+		srv.From, srv.Interface, srv.LocalAddr = src.From, src.Interface, src.LocalAddr
+		srv.Sources = []Source{src}
+		cfg.log.Debug("search response", ssdplog.KeyEvent, "response", ssdplog.KeyFrom, a.String(), ssdplog.KeyST, srv.Type, ssdplog.KeyUSN, srv.USN)
+		if !fn(srv) {
+			return errStopSearch
+		}
 		return nil
 	}
-	d := time.Second * time.Duration(waitSec)
-	if err := conn.ReadPackets(d, h); err != nil {
-		return nil, err
+	err = conn.ReadPackets(d, h)
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		return ctxErr
+	}
+	if err != nil && !errors.Is(err, errStopSearch) {
+		return err
 	}
+	return nil
+}
 
-	return list, err
+// errStopSearch is used to stop searching by the callback.
+var errStopSearch = errors.New("stop search")
+
+// sendSearch sends M-SEARCH for each queries to each multicast groups.
+func sendSearch(conn TransportConn, queries []string, mx int) error {
+	for _, addr := range conn.Groups() {
+		for _, q := range queries {
+			msg, err := buildSearch(addr, q, mx)
+			if err != nil {
+				return err
+			}
+			if _, err := conn.WriteTo(bytesData(msg), addr, nil); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// retransmitSearch sends M-SEARCH n times with spacing, until done is
+// closed.  Retransmissions are done in wait, and MX for them is reduced to
+// remaining time, so responses will arrive in wait.
+func retransmitSearch(conn TransportConn, queries []string, wait time.Duration, n int, spacing time.Duration, done <-chan struct{}, log *ssdplog.Logger) {
+	for i := 1; i <= n; i++ {
+		mx := int((wait - time.Duration(i)*spacing) / time.Second)
+		if mx < 1 {
+			return
+		}
+		t := time.NewTimer(spacing)
+		select {
+		case <-t.C:
+		case <-done:
+			t.Stop()
+			return
+		}
+		if err := sendSearch(conn, queries, mx); err != nil {
+			log.Error("failed to retransmit search", ssdplog.KeyEvent, "search", ssdplog.KeyError, err)
+			return
+		}
+	}
+}
+
+// matchQuery returns a query which a response with ST answered.  This
+// returns an empty string when no queries matched.
+func matchQuery(queries []string, st string) string {
+	matched := ""
+	for _, q := range queries {
+		if q == st {
+			return q
+		}
+		if q == All && matched == "" {
+			matched = q
+		}
+	}
+	return matched
 }
 
 func buildSearch(raddr net.Addr, searchType string, waitSec int) ([]byte, error) {
-	b := new(bytes.Buffer)
-	// FIXME: error should be checked.
-	b.WriteString("M-SEARCH * HTTP/1.1\r\n")
-	fmt.Fprintf(b, "HOST: %s\r\n", raddr.String())
-	fmt.Fprintf(b, "MAN: %q\r\n", "ssdp:discover")
-	fmt.Fprintf(b, "MX: %d\r\n", waitSec)
-	fmt.Fprintf(b, "ST: %s\r\n", searchType)
-	b.WriteString("\r\n")
-	return b.Bytes(), nil
+	m := &MSearch{
+		Host: raddr.String(),
+		MAN:  manDiscover,
+		MX:   waitSec,
+		ST:   searchType,
+	}
+	return m.Marshal(), nil
 }
 
 var (
 	errWithoutHTTPPrefix = errors.New("without HTTP prefix")
 )
 
-var endOfHeader = []byte{'\r', '\n', '\r', '\n'}
-
 func parseService(data []byte) (*Service, error) {
 	if !bytes.HasPrefix(data, []byte("HTTP")) {
 		return nil, errWithoutHTTPPrefix
 	}
-	// Complement newlines on tail of header for buggy SSDP responses.
-	if !bytes.HasSuffix(data, endOfHeader) {
-		// why we should't use append() for this purpose:
-		// https://play.golang.org/p/IM1pONW9lqm
-		data = bytes.Join([][]byte{data, endOfHeader}, nil)
-	}
-	resp, err := http.ReadResponse(bufio.NewReader(bytes.NewReader(data)), nil)
+	msg, err := ParseMessage(data)
 	if err != nil {
 		return nil, err
 	}
-	defer resp.Body.Close()
+	resp, ok := msg.(*SearchResponse)
+	if !ok {
+		return nil, errWithoutHTTPPrefix
+	}
 	return &Service{
-		Type:      resp.Header.Get("ST"),
-		USN:       resp.Header.Get("USN"),
-		Location:  resp.Header.Get("LOCATION"),
-		Server:    resp.Header.Get("SERVER"),
-		rawHeader: resp.Header,
+		Type:      resp.ST,
+		USN:       resp.USN,
+		Location:  resp.Location,
+		Server:    resp.Server,
+		rawHeader: resp.Header(),
 	}, nil
 }
+
+// interfaceName returns a name of the interface, or an empty string for nil.
+func interfaceName(ifi *net.Interface) string {
+	if ifi == nil {
+		return ""
+	}
+	return ifi.Name
+}
+
+// interfaceByIndex returns an interface for the index.  This returns nil
+// when the index is 0 or the interface is not found.
+func interfaceByIndex(index int) *net.Interface {
+	if index <= 0 {
+		return nil
+	}
+	ifi, err := net.InterfaceByIndex(index)
+	if err != nil {
+		return nil
+	}
+	return ifi
+}
@@ -1,10 +1,17 @@
 package ssdp
 
 import (
+	"context"
+	"errors"
 	"net"
+	"path/filepath"
+	"reflect"
 	"strings"
 	"sync"
 	"testing"
+	"time"
+
+	"github.com/koron/go-ssdp/internal/multicast"
 )
 
 func testMaxAge(t *testing.T, s string, expect int) {
@@ -234,3 +241,296 @@ func TestSearch_AdvetiserWithHost(t *testing.T) {
 		}
 	}
 }
+
+func TestSearch_ResponseDualStack(t *testing.T) {
+	a, err := Advertise("test:search+responsedualstack", "usn:search+responsedualstack", "location:search+responsedualstack", "server:search+responsedualstack", 600, DualStack())
+	if err != nil {
+		t.Fatalf("failed to Advertise: %s", err)
+	}
+	t.Cleanup(func() {
+		a.Close()
+	})
+
+	srvs, err := Search("test:search+responsedualstack", 1, "", DualStack())
+	if err != nil {
+		t.Fatalf("failed to Search: %s", err)
+	}
+	// responses for IPv4 and IPv6 are merged into one.
+	if len(srvs) != 1 {
+		t.Fatalf("unexpected number of services: want=%d got=%d", 1, len(srvs))
+	}
+	s := srvs[0]
+	if s.USN != "usn:search+responsedualstack" {
+		t.Errorf("unexpected service usn: want=%q got=%q", "usn:search+responsedualstack", s.USN)
+	}
+	var v4, v6 bool
+	for i, src := range s.Sources {
+		if src.Interface == nil {
+			t.Errorf("no interfaces for source#%d: %s", i, src.From)
+		}
+		if src.From.(*net.UDPAddr).IP.To4() != nil {
+			v4 = true
+		} else {
+			v6 = true
+		}
+	}
+	if !v4 || !v6 {
+		t.Errorf("sources should have both of IPv4 and IPv6: %+v", s.Sources)
+	}
+}
+
+func TestSearch_UDAHeaders(t *testing.T) {
+	store := FileBootIDStore(filepath.Join(t.TempDir(), "bootid"))
+	if err := store.StoreBootID(41); err != nil {
+		t.Fatalf("failed to store BOOTID: %s", err)
+	}
+	a, err := Advertise("test:search+udaheaders", "usn:search+udaheaders", "location:search+udaheaders", "server:search+udaheaders", 600, BootIDFrom(store), ConfigID(7), SearchPort(50000))
+	if err != nil {
+		t.Fatalf("failed to Advertise: %s", err)
+	}
+	t.Cleanup(func() {
+		a.Close()
+	})
+
+	srvs, err := Search("test:search+udaheaders", 1, "")
+	if err != nil {
+		t.Fatalf("failed to Search: %s", err)
+	}
+	if len(srvs) == 0 {
+		t.Fatal("no services found")
+	}
+	for i, s := range srvs {
+		if v := s.BootID(); v != 42 {
+			t.Errorf("unexpected service#%d BOOTID: want=%d got=%d", i, 42, v)
+		}
+		if v := s.ConfigID(); v != 7 {
+			t.Errorf("unexpected service#%d CONFIGID: want=%d got=%d", i, 7, v)
+		}
+		if v := s.SearchPort(); v != 50000 {
+			t.Errorf("unexpected service#%d SEARCHPORT: want=%d got=%d", i, 50000, v)
+		}
+	}
+}
+
+func TestSearchContext_Deadline(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	_, err := SearchContext(ctx, "test:searchcontext+deadline", 3, "")
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("unexpected error: want=%v got=%v", context.DeadlineExceeded, err)
+	}
+	if d := time.Since(start); d >= time.Second {
+		t.Errorf("search is not interrupted by deadline: %s", d)
+	}
+}
+
+func TestSearchContext_Canceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err := SearchContext(ctx, "test:searchcontext+canceled", 1, "")
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("unexpected error: want=%v got=%v", context.Canceled, err)
+	}
+}
+
+func TestSearchFunc_Stop(t *testing.T) {
+	a, err := Advertise("test:searchfunc+stop", "usn:searchfunc+stop", "location:searchfunc+stop", "server:searchfunc+stop", 600)
+	if err != nil {
+		t.Fatalf("failed to Advertise: %s", err)
+	}
+	t.Cleanup(func() {
+		a.Close()
+	})
+
+	var srvs []*Service
+	start := time.Now()
+	err = SearchFunc(context.Background(), "test:searchfunc+stop", 3, "", func(s *Service) bool {
+		srvs = append(srvs, s)
+		return false
+	})
+	if err != nil {
+		t.Fatalf("failed to SearchFunc: %s", err)
+	}
+	if d := time.Since(start); d >= 3*time.Second {
+		t.Errorf("search is not stopped by the callback: %s", d)
+	}
+	if len(srvs) != 1 {
+		t.Fatalf("unexpected number of services: want=%d got=%d", 1, len(srvs))
+	}
+	if srvs[0].USN != "usn:searchfunc+stop" {
+		t.Errorf("unexpected service usn: want=%q got=%q", "usn:searchfunc+stop", srvs[0].USN)
+	}
+}
+
+// startMismatchedResponder starts a fake device which responds to any
+// M-SEARCH with the mismatched ST.
+func startMismatchedResponder(t *testing.T, st, usn string) {
+	t.Helper()
+	conn, err := multicast.Listen(multicast.RecvAddrResolver)
+	if err != nil {
+		t.Fatalf("failed to listen: %s", err)
+	}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		conn.ReadPackets(0, func(from net.Addr, data []byte, _ multicast.PacketInfo) error {
+			if !strings.HasPrefix(string(data), "M-SEARCH ") {
+				return nil
+			}
+			msg := buildOK(st, usn, "location:mismatched", "server:mismatched", 600, "", noUDAHeader)
+			conn.WriteTo(multicast.BytesDataProvider(msg), from)
+			return nil
+		})
+	}()
+	t.Cleanup(func() {
+		conn.Close()
+		<-done
+	})
+}
+
+func TestSearch_FilterST(t *testing.T) {
+	startMismatchedResponder(t, "test:search+filterst+other", "usn:search+filterst")
+
+	srvs, err := Search("test:search+filterst", 1, "")
+	if err != nil {
+		t.Fatalf("failed to Search: %s", err)
+	}
+	for _, s := range srvs {
+		if s.USN == "usn:search+filterst" {
+			t.Errorf("mismatched service found: %+v", s)
+		}
+	}
+
+	srvs, err = Search("test:search+filterst", 1, "", AcceptAnyST())
+	if err != nil {
+		t.Fatalf("failed to Search: %s", err)
+	}
+	found := false
+	for _, s := range srvs {
+		if s.USN == "usn:search+filterst" {
+			found = true
+		}
+	}
+	if !found {
+		t.Error("mismatched service not found with AcceptAnyST")
+	}
+}
+
+func TestMatchQuery(t *testing.T) {
+	queries := []string{"test:foo", All, "test:bar"}
+	for i, tc := range []struct {
+		st, want string
+	}{
+		{"test:foo", "test:foo"},
+		{"test:bar", "test:bar"},
+		{"test:baz", All},
+	} {
+		if got := matchQuery(queries, tc.st); got != tc.want {
+			t.Errorf("#%d matchQuery(%q) mismatch: want=%q got=%q", i, tc.st, tc.want, got)
+		}
+	}
+	if got := matchQuery([]string{"test:foo"}, "test:bar"); got != "" {
+		t.Errorf("unexpected match: %q", got)
+	}
+}
+
+func TestSearch_Retransmit(t *testing.T) {
+	var mu sync.Mutex
+	var mm []*SearchMessage
+	m := newTestMonitor(t, "test:search+retransmit", nil, nil, func(m *SearchMessage) {
+		mu.Lock()
+		mm = append(mm, m)
+		mu.Unlock()
+	})
+
+	start := time.Now()
+	_, err := Search("test:search+retransmit", 2, "", Retransmit(2, 300*time.Millisecond))
+	if err != nil {
+		t.Fatalf("failed to Search: %s", err)
+	}
+	if d := time.Since(start); d > 2500*time.Millisecond {
+		t.Errorf("overall wait is extended: %s", d)
+	}
+	m.Close()
+
+	mu.Lock()
+	t.Cleanup(mu.Unlock)
+
+	// 3 (1 + 2 retransmissions) searches for each interfaces.
+	if len(mm) < 3 {
+		t.Fatalf("too few searches: %d", len(mm))
+	}
+	var mx1 bool
+	for _, m := range mm {
+		if m.Header().Get("MX") == "1" {
+			mx1 = true
+		}
+	}
+	if !mx1 {
+		t.Error("MX is not reduced for retransmissions")
+	}
+}
+
+func TestSearch_SearchTypes(t *testing.T) {
+	for _, name := range []string{"foo", "bar", "baz"} {
+		a, err := Advertise("test:search+searchtypes+"+name, "usn:search+searchtypes+"+name, "location:search+searchtypes", "server:search+searchtypes", 600)
+		if err != nil {
+			t.Fatalf("failed to Advertise: %s", err)
+		}
+		t.Cleanup(func() {
+			a.Close()
+		})
+	}
+
+	srvs, err := Search("test:search+searchtypes+foo", 1, "", SearchTypes("test:search+searchtypes+bar"))
+	if err != nil {
+		t.Fatalf("failed to Search: %s", err)
+	}
+	got := map[string]string{}
+	for _, s := range srvs {
+		got[s.USN] = s.Query
+	}
+	want := map[string]string{
+		"usn:search+searchtypes+foo": "test:search+searchtypes+foo",
+		"usn:search+searchtypes+bar": "test:search+searchtypes+bar",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("unexpected services:\nwant=%+v\n got=%+v", want, got)
+	}
+}
+
+func TestSearch_ServiceSource(t *testing.T) {
+	a, err := Advertise("test:search+servicesource", "usn:search+servicesource", "location:search+servicesource", "server:search+servicesource", 600)
+	if err != nil {
+		t.Fatalf("failed to Advertise: %s", err)
+	}
+	t.Cleanup(func() {
+		a.Close()
+	})
+
+	srvs, err := Search("test:search+servicesource", 1, "")
+	if err != nil {
+		t.Fatalf("failed to Search: %s", err)
+	}
+	if len(srvs) == 0 {
+		t.Fatal("no services found")
+	}
+	for i, s := range srvs {
+		if s.From == nil {
+			t.Errorf("no senders for service#%d", i)
+		}
+		if s.Interface == nil {
+			t.Errorf("no interfaces for service#%d", i)
+		}
+		// responses are unicast to the socket for search.
+		laddr, ok := s.LocalAddr.(*net.UDPAddr)
+		if !ok {
+			t.Errorf("unexpected local address for service#%d: %+v", i, s.LocalAddr)
+			continue
+		}
+		if laddr.IP.IsMulticast() || laddr.Port == 0 {
+			t.Errorf("unexpected local address for service#%d: %s", i, laddr)
+		}
+	}
+}
@@ -0,0 +1,139 @@
+package ssdp
+
+import (
+	"errors"
+	"slices"
+)
+
+// Server advertises multiple services on a shared socket.
+// Services can be registered and unregistered at runtime.
+type Server struct {
+	a *Advertiser
+}
+
+// NewServer starts a server to advertise services without any services.
+func NewServer(opts ...Option) (*Server, error) {
+	a, err := advertise(nil, opts)
+	if err != nil {
+		return nil, err
+	}
+	return &Server{a: a}, nil
+}
+
+var (
+	// ErrAlreadyRegistered is returned by Server.Register() when a USN has
+	// been registered already.
+	ErrAlreadyRegistered = errors.New("USN registered already")
+
+	// ErrNotRegistered is returned by Server.Unregister() when a USN is not
+	// registered.
+	ErrNotRegistered = errors.New("USN not registered")
+)
+
+// Register adds a service to advertise, and announces ssdp:alive message
+// for it.
+// location should be a string or a ssdp.LocationProvider.
+func (s *Server) Register(st, usn string, location any, server string, maxAge int) error {
+	targets, err := newTargets([][2]string{{st, usn}}, location, server, maxAge)
+	if err != nil {
+		return err
+	}
+	return s.register(targets)
+}
+
+// RegisterDevice adds a root device with its embedded devices and services
+// to advertise, and announces ssdp:alive message for them.
+// location should be a string or a ssdp.LocationProvider.
+func (s *Server) RegisterDevice(root *Device, location any, server string, maxAge int) error {
+	targets, err := root.targets(location, server, maxAge)
+	if err != nil {
+		return err
+	}
+	return s.register(targets)
+}
+
+func (s *Server) register(targets []target) error {
+	return s.a.connGuard(func() error {
+		s.a.tmu.Lock()
+		for _, t := range targets {
+			if s.indexOf(t.usn) >= 0 {
+				s.a.tmu.Unlock()
+				return ErrAlreadyRegistered
+			}
+		}
+		s.a.targets = slices.Concat(s.a.targets, targets)
+		s.a.tmu.Unlock()
+		return s.a.sendAlive(targets)
+	})
+}
+
+// Unregister removes a service which has the USN, and announces ssdp:byebye
+// message for it.
+func (s *Server) Unregister(usn string) error {
+	return s.unregister([]string{usn})
+}
+
+// UnregisterDevice removes a root device with its embedded devices and
+// services, and announces ssdp:byebye message for them.
+func (s *Server) UnregisterDevice(root *Device) error {
+	pairs, err := root.pairs()
+	if err != nil {
+		return err
+	}
+	usns := make([]string, 0, len(pairs))
+	for _, p := range pairs {
+		usns = append(usns, p[1])
+	}
+	return s.unregister(usns)
+}
+
+func (s *Server) unregister(usns []string) error {
+	return s.a.connGuard(func() error {
+		s.a.tmu.Lock()
+		for _, usn := range usns {
+			if s.indexOf(usn) < 0 {
+				s.a.tmu.Unlock()
+				return ErrNotRegistered
+			}
+		}
+		var removed []target
+		s.a.targets = slices.DeleteFunc(slices.Clone(s.a.targets), func(t target) bool {
+			if slices.Contains(usns, t.usn) {
+				removed = append(removed, t)
+				return true
+			}
+			return false
+		})
+		s.a.tmu.Unlock()
+		return s.a.sendBye(removed)
+	})
+}
+
+// indexOf returns an index of target which has the USN, or -1.
+// This should be called with holding s.a.tmu.
+func (s *Server) indexOf(usn string) int {
+	return slices.IndexFunc(s.a.targets, func(t target) bool {
+		return t.usn == usn
+	})
+}
+
+// Alive announces ssdp:alive message for all registered services.
+func (s *Server) Alive() error {
+	return s.a.Alive()
+}
+
+// Bye announces ssdp:byebye message for all registered services.
+func (s *Server) Bye() error {
+	return s.a.Bye()
+}
+
+// Update announces ssdp:update message for all registered services, then
+// increments BOOTID.
+func (s *Server) Update() error {
+	return s.a.Update()
+}
+
+// Close stops advertisement.
+func (s *Server) Close() error {
+	return s.a.Close()
+}
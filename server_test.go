@@ -0,0 +1,129 @@
+package ssdp
+
+import (
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestServer_Register(t *testing.T) {
+	var mu sync.Mutex
+	var alives []*AliveMessage
+	var byes []*ByeMessage
+	m := &Monitor{
+		Alive: func(m *AliveMessage) {
+			if strings.HasPrefix(m.USN, "usn:server+register") {
+				mu.Lock()
+				alives = append(alives, m)
+				mu.Unlock()
+			}
+		},
+		Bye: func(m *ByeMessage) {
+			if strings.HasPrefix(m.USN, "usn:server+register") {
+				mu.Lock()
+				byes = append(byes, m)
+				mu.Unlock()
+			}
+		},
+	}
+	if err := m.Start(); err != nil {
+		t.Fatalf("failed to start Monitor: %s", err)
+	}
+	t.Cleanup(func() {
+		m.Close()
+	})
+
+	s, err := NewServer()
+	if err != nil {
+		t.Fatalf("failed to NewServer: %s", err)
+	}
+	t.Cleanup(func() {
+		s.Close()
+	})
+	for _, name := range []string{"foo", "bar"} {
+		err := s.Register("test:server+register+"+name, "usn:server+register+"+name, "location:server+register+"+name, "server:server+register", 600)
+		if err != nil {
+			t.Fatalf("failed to register %s: %s", name, err)
+		}
+	}
+	err = s.Register("test:server+register+foo", "usn:server+register+foo", "location:server+register+foo", "server:server+register", 600)
+	if err != ErrAlreadyRegistered {
+		t.Errorf("unexpected error for duplicated USN: want=%v got=%v", ErrAlreadyRegistered, err)
+	}
+
+	srvs, err := Search(All, 1, "")
+	if err != nil {
+		t.Fatalf("failed to Search: %s", err)
+	}
+	found := map[string]string{}
+	for _, s := range srvs {
+		if strings.HasPrefix(s.USN, "usn:server+register") {
+			found[s.USN] = s.Location
+		}
+	}
+	if len(found) != 2 {
+		t.Errorf("unexpected services: %+v", found)
+	}
+	if loc := found["usn:server+register+bar"]; loc != "location:server+register+bar" {
+		t.Errorf("unexpected location: want=%q got=%q", "location:server+register+bar", loc)
+	}
+
+	if err := s.Unregister("usn:server+register+foo"); err != nil {
+		t.Fatalf("failed to unregister: %s", err)
+	}
+	if err := s.Unregister("usn:server+register+foo"); err != ErrNotRegistered {
+		t.Errorf("unexpected error for unregistered USN: want=%v got=%v", ErrNotRegistered, err)
+	}
+
+	srvs, err = Search("test:server+register+foo", 1, "")
+	if err != nil {
+		t.Fatalf("failed to Search: %s", err)
+	}
+	if len(srvs) > 0 {
+		t.Errorf("unregistered service found: %+v", srvs)
+	}
+
+	time.Sleep(monitorWait)
+	m.Close()
+
+	mu.Lock()
+	t.Cleanup(mu.Unlock)
+	aliveUSNs := map[string]bool{}
+	for _, m := range alives {
+		aliveUSNs[m.USN] = true
+	}
+	if !aliveUSNs["usn:server+register+foo"] || !aliveUSNs["usn:server+register+bar"] {
+		t.Errorf("alives not detected for all registered services: %+v", aliveUSNs)
+	}
+	if len(byes) < 1 {
+		t.Fatal("no byes detected")
+	}
+	for i, m := range byes {
+		if m.USN != "usn:server+register+foo" {
+			t.Errorf("unexpected bye#%d usn: want=%q got=%q", i, "usn:server+register+foo", m.USN)
+		}
+	}
+}
+
+func TestServer_RegisterDevice(t *testing.T) {
+	s, err := NewServer()
+	if err != nil {
+		t.Fatalf("failed to NewServer: %s", err)
+	}
+	t.Cleanup(func() {
+		s.Close()
+	})
+	if err := s.RegisterDevice(testDevice, "location:server+registerdevice", "server:server+registerdevice", 600); err != nil {
+		t.Fatalf("failed to register device: %s", err)
+	}
+	if n := len(s.a.currentTargets()); n != 8 {
+		t.Errorf("unexpected number of targets: want=%d got=%d", 8, n)
+	}
+	if err := s.UnregisterDevice(testDevice); err != nil {
+		t.Fatalf("failed to unregister device: %s", err)
+	}
+	if n := len(s.a.currentTargets()); n != 0 {
+		t.Errorf("unexpected number of targets: want=%d got=%d", 0, n)
+	}
+}
@@ -17,21 +17,41 @@ func init() {
 	}
 }
 
+// IPv6 multicast addresses for SSDP in each scope, which can be used with
+// IPv6Scopes() option.
+const (
+	// IPv6LinkLocal is a multicast address in link-local scope.
+	IPv6LinkLocal = "FF02::C"
+
+	// IPv6SiteLocal is a multicast address in site-local scope.
+	IPv6SiteLocal = "FF05::C"
+
+	// IPv6OrganizationLocal is a multicast address in organization-local
+	// scope.
+	IPv6OrganizationLocal = "FF08::C"
+)
+
 // Interfaces specify target interfaces to multicast.  If no interfaces are
 // specified, all interfaces will be used.
+// This is a default for all instances, UseInterfaces() option overrides it.
 var Interfaces []net.Interface
 
 // Logger is default logger for SSDP module.
+// UseLogger() option overrides it.
 var Logger *log.Logger
 
 // SetMulticastRecvAddrIPv4 updates multicast address where to receive packets.
 // This never fail now.
+// This is a default for all instances, MulticastRecvAddr() option overrides
+// it.
 func SetMulticastRecvAddrIPv4(addr string) error {
 	return multicast.SetRecvAddrIPv4(addr)
 }
 
 // SetMulticastSendAddrIPv4 updates a UDP address to send multicast packets.
 // This never fail now.
+// This is a default for all instances, MulticastSendAddr() option overrides
+// it.
 func SetMulticastSendAddrIPv4(addr string) error {
 	return multicast.SetSendAddrIPv4(addr)
 }
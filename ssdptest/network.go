@@ -0,0 +1,423 @@
+/*
+Package ssdptest provides an in-memory virtual multicast network, to test
+SSDP hermetically.
+
+	network := ssdptest.NewNetwork()
+	h1 := network.NewHost("192.0.2.1/24")
+	h2 := network.NewHost("192.0.2.2/24")
+	ad, err := ssdp.Advertise(st, usn, loc, server, 1800, ssdp.UseTransport(h1))
+	list, err := ssdp.Search(st, 1, "", ssdp.UseTransport(h2))
+*/
+package ssdptest
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/koron/go-ssdp"
+)
+
+// Port is a port to listen multicast messages.
+const Port = 1900
+
+// firstEphemeralPort is a first port which is assigned to connections by
+// ListenUnicast() without ports.
+const firstEphemeralPort = 49152
+
+// firstIndex is an index of the first interface of a host.  It is large
+// enough to avoid conflicts with real interfaces.
+const firstIndex = 1001
+
+var (
+	groupIPv4 = &net.UDPAddr{IP: net.IPv4(239, 255, 255, 250), Port: Port}
+	groupIPv6 = &net.UDPAddr{IP: net.ParseIP("ff02::c"), Port: Port}
+)
+
+// Network is an in-memory virtual multicast network, which connects hosts.
+// Interfaces of hosts which have addresses in a same network are connected
+// each other.
+type Network struct {
+	mu     sync.Mutex
+	hosts  []*Host
+	loss   float64
+	delay  time.Duration
+	jitter time.Duration
+}
+
+// NewNetwork creates a new virtual network.
+func NewNetwork() *Network {
+	return &Network{}
+}
+
+// SetLoss sets a probability to drop each packet, between 0 and 1.
+func (n *Network) SetLoss(p float64) {
+	n.mu.Lock()
+	n.loss = p
+	n.mu.Unlock()
+}
+
+// SetDelay sets a delay to deliver each packet.  A random duration less
+// than jitter is added to d for each packet.
+func (n *Network) SetDelay(d, jitter time.Duration) {
+	n.mu.Lock()
+	n.delay = d
+	n.jitter = jitter
+	n.mu.Unlock()
+}
+
+// NewHost adds a new host to the network.  Each address in CIDR notation,
+// like "192.0.2.1/24" or "2001:db8::1/64", makes an interface which is
+// named "eth0", "eth1" and so on.
+// This panics when an address is invalid.
+func (n *Network) NewHost(addrs ...string) *Host {
+	h := &Host{network: n, nextPort: firstEphemeralPort}
+	for i, s := range addrs {
+		ip, ipnet, err := net.ParseCIDR(s)
+		if err != nil {
+			panic(fmt.Sprintf("ssdptest: invalid address: %s", err))
+		}
+		ipnet.IP = ip
+		h.ifaces = append(h.ifaces, &iface{
+			ifi: net.Interface{
+				Index: firstIndex + i,
+				MTU:   1500,
+				Name:  "eth" + strconv.Itoa(i),
+				Flags: net.FlagUp | net.FlagBroadcast | net.FlagMulticast,
+			},
+			ipnet: ipnet,
+		})
+	}
+	n.mu.Lock()
+	n.hosts = append(n.hosts, h)
+	n.mu.Unlock()
+	return h
+}
+
+// deliver delivers a packet to a connection, with loss and delay.
+func (n *Network) deliver(c *conn, p packet) {
+	n.mu.Lock()
+	loss, delay, jitter := n.loss, n.delay, n.jitter
+	n.mu.Unlock()
+	if loss > 0 && rand.Float64() < loss {
+		return
+	}
+	if jitter > 0 {
+		delay += rand.N(jitter)
+	}
+	if delay <= 0 {
+		c.enqueue(p)
+		return
+	}
+	time.AfterFunc(delay, func() {
+		c.enqueue(p)
+	})
+}
+
+// multicast sends a packet to all connections which listen multicast
+// messages, on interfaces which are connected with src.
+func (n *Network) multicast(src *iface, port int, group *net.UDPAddr, data []byte) {
+	from := &net.UDPAddr{IP: src.ipnet.IP, Port: port}
+	n.mu.Lock()
+	hosts := slices.Clone(n.hosts)
+	n.mu.Unlock()
+	for _, h := range hosts {
+		for _, d := range h.ifaces {
+			if !d.connected(src) {
+				continue
+			}
+			for _, c := range h.multicastConns(group.Port) {
+				n.deliver(c, packet{from: from, data: slices.Clone(data), ifi: d.ifi, dst: group})
+			}
+		}
+	}
+}
+
+// unicast sends a packet to a connection which listens on to address.
+func (n *Network) unicast(src *iface, port int, to *net.UDPAddr, data []byte) {
+	from := &net.UDPAddr{IP: src.ipnet.IP, Port: port}
+	n.mu.Lock()
+	hosts := slices.Clone(n.hosts)
+	n.mu.Unlock()
+	for _, h := range hosts {
+		for _, d := range h.ifaces {
+			if !d.ipnet.IP.Equal(to.IP) || !d.connected(src) {
+				continue
+			}
+			if c := h.conn(to.Port); c != nil {
+				n.deliver(c, packet{from: from, data: slices.Clone(data), ifi: d.ifi, dst: to})
+			}
+			return
+		}
+	}
+}
+
+// Host is a host on a virtual network.  It implements ssdp.Transport.
+type Host struct {
+	network *Network
+	ifaces  []*iface
+
+	mu       sync.Mutex
+	conns    []*conn
+	nextPort int
+}
+
+var _ ssdp.Transport = (*Host)(nil)
+
+// Interfaces returns interfaces of the host.
+func (h *Host) Interfaces() []net.Interface {
+	list := make([]net.Interface, 0, len(h.ifaces))
+	for _, f := range h.ifaces {
+		list = append(list, f.ifi)
+	}
+	return list
+}
+
+// ListenMulticast listens multicast messages on Port.
+func (h *Host) ListenMulticast() (ssdp.TransportConn, error) {
+	return h.listen(Port, true), nil
+}
+
+// ListenUnicast listens on a port of laddr.  A port is assigned when laddr
+// is empty or has no ports.  A host part of laddr is ignored.
+func (h *Host) ListenUnicast(laddr string) (ssdp.TransportConn, error) {
+	port := 0
+	if laddr != "" {
+		addr, err := net.ResolveUDPAddr("udp", laddr)
+		if err != nil {
+			return nil, err
+		}
+		port = addr.Port
+	}
+	if port == 0 {
+		h.mu.Lock()
+		port = h.nextPort
+		h.nextPort++
+		h.mu.Unlock()
+	} else if h.conn(port) != nil {
+		return nil, fmt.Errorf("ssdptest: port %d is in use", port)
+	}
+	return h.listen(port, false), nil
+}
+
+func (h *Host) listen(port int, multicast bool) *conn {
+	c := &conn{
+		host:      h,
+		port:      port,
+		multicast: multicast,
+		inbox:     make(chan packet, 1024),
+		done:      make(chan struct{}),
+	}
+	h.mu.Lock()
+	h.conns = append(h.conns, c)
+	h.mu.Unlock()
+	return c
+}
+
+// conn returns a connection which listens on the port.
+func (h *Host) conn(port int) *conn {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for _, c := range h.conns {
+		if c.port == port {
+			return c
+		}
+	}
+	return nil
+}
+
+// multicastConns returns connections which listen multicast messages on
+// the port.
+func (h *Host) multicastConns(port int) []*conn {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	var list []*conn
+	for _, c := range h.conns {
+		if c.multicast && c.port == port {
+			list = append(list, c)
+		}
+	}
+	return list
+}
+
+func (h *Host) remove(c *conn) {
+	h.mu.Lock()
+	h.conns = slices.DeleteFunc(h.conns, func(v *conn) bool {
+		return v == c
+	})
+	h.mu.Unlock()
+}
+
+// route returns an interface to send a packet to an address.
+func (h *Host) route(to *net.UDPAddr, ifi *net.Interface) (*iface, error) {
+	v4 := to.IP.To4() != nil
+	for _, f := range h.ifaces {
+		if (f.ipnet.IP.To4() != nil) != v4 {
+			continue
+		}
+		if ifi != nil {
+			if f.ifi.Index == ifi.Index {
+				return f, nil
+			}
+			continue
+		}
+		if to.IP.IsMulticast() || f.ipnet.Contains(to.IP) {
+			return f, nil
+		}
+	}
+	return nil, fmt.Errorf("ssdptest: no route to %s", to)
+}
+
+// iface is an interface of a host.
+type iface struct {
+	ifi   net.Interface
+	ipnet *net.IPNet
+}
+
+// connected checks the interface is connected with src or not.
+func (f *iface) connected(src *iface) bool {
+	return f.ipnet.Contains(src.ipnet.IP) && src.ipnet.Contains(f.ipnet.IP)
+}
+
+type packet struct {
+	from *net.UDPAddr
+	data []byte
+	ifi  net.Interface
+	dst  *net.UDPAddr
+}
+
+// conn is a connection on a host.  It implements ssdp.TransportConn.
+type conn struct {
+	host      *Host
+	port      int
+	multicast bool
+	inbox     chan packet
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+var (
+	_ ssdp.TransportConn          = (*conn)(nil)
+	_ ssdp.InterfaceAddrsProvider = (*conn)(nil)
+)
+
+func (c *conn) Groups() []*net.UDPAddr {
+	var v4, v6 bool
+	for _, f := range c.host.ifaces {
+		if f.ipnet.IP.To4() != nil {
+			v4 = true
+		} else {
+			v6 = true
+		}
+	}
+	var groups []*net.UDPAddr
+	if v4 {
+		groups = append(groups, groupIPv4)
+	}
+	if v6 {
+		groups = append(groups, groupIPv6)
+	}
+	return groups
+}
+
+func (c *conn) WriteTo(data func(*net.Interface) []byte, to net.Addr, ifi *net.Interface) (int, error) {
+	if c.closed() {
+		return 0, net.ErrClosed
+	}
+	uto, ok := to.(*net.UDPAddr)
+	if !ok {
+		return 0, fmt.Errorf("ssdptest: unsupported address: %s", to)
+	}
+	if !uto.IP.IsMulticast() {
+		src, err := c.host.route(uto, ifi)
+		if err != nil {
+			return 0, err
+		}
+		b := data(&src.ifi)
+		c.host.network.unicast(src, c.port, uto, b)
+		return len(b), nil
+	}
+	sum := 0
+	v4 := uto.IP.To4() != nil
+	for _, src := range c.host.ifaces {
+		if (src.ipnet.IP.To4() != nil) != v4 || (ifi != nil && src.ifi.Index != ifi.Index) {
+			continue
+		}
+		b := data(&src.ifi)
+		c.host.network.multicast(src, c.port, uto, b)
+		sum += len(b)
+	}
+	if sum == 0 {
+		return 0, fmt.Errorf("ssdptest: no interfaces to send to %s", to)
+	}
+	return sum, nil
+}
+
+func (c *conn) ReadPackets(timeout time.Duration, h func(net.Addr, []byte, *net.Interface, net.Addr) error) error {
+	var tc <-chan time.Time
+	if timeout > 0 {
+		t := time.NewTimer(timeout)
+		defer t.Stop()
+		tc = t.C
+	}
+	for {
+		select {
+		case <-c.done:
+			return io.EOF
+		case <-tc:
+			return nil
+		case p := <-c.inbox:
+			if err := h(p.from, p.data, &p.ifi, p.dst); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func (c *conn) LocalAddr() net.Addr {
+	return &net.UDPAddr{IP: net.IPv4zero, Port: c.port}
+}
+
+func (c *conn) Close() error {
+	err := errors.New("ssdptest: closed already")
+	c.closeOnce.Do(func() {
+		close(c.done)
+		c.host.remove(c)
+		err = nil
+	})
+	return err
+}
+
+// InterfaceAddrs returns addresses of a virtual interface.
+func (c *conn) InterfaceAddrs(ifi *net.Interface) ([]net.Addr, error) {
+	for _, f := range c.host.ifaces {
+		if f.ifi.Index == ifi.Index {
+			return []net.Addr{f.ipnet}, nil
+		}
+	}
+	return nil, fmt.Errorf("ssdptest: no interfaces: %s", ifi.Name)
+}
+
+func (c *conn) closed() bool {
+	select {
+	case <-c.done:
+		return true
+	default:
+		return false
+	}
+}
+
+func (c *conn) enqueue(p packet) {
+	select {
+	case <-c.done:
+	case c.inbox <- p:
+	default:
+		// drop a packet when the inbox is full, like UDP.
+	}
+}
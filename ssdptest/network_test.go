@@ -0,0 +1,268 @@
+package ssdptest
+
+import (
+	"io"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/koron/go-ssdp"
+)
+
+func newTestAdvertiser(t *testing.T, h *Host, st string, location any) *ssdp.Advertiser {
+	t.Helper()
+	ad, err := ssdp.Advertise(st, "uuid:"+st, location, "test", 600, ssdp.UseTransport(h))
+	if err != nil {
+		t.Fatalf("failed to advertise: %s", err)
+	}
+	t.Cleanup(func() {
+		ad.Close()
+	})
+	return ad
+}
+
+func search(t *testing.T, h *Host, st string) []ssdp.Service {
+	t.Helper()
+	list, err := ssdp.Search(st, 1, "", ssdp.UseTransport(h))
+	if err != nil {
+		t.Fatalf("failed to search: %s", err)
+	}
+	return list
+}
+
+func TestSearch(t *testing.T) {
+	n := NewNetwork()
+	h1 := n.NewHost("192.0.2.1/24")
+	h2 := n.NewHost("192.0.2.2/24")
+	newTestAdvertiser(t, h1, "test:ssdptest+search", "http://192.0.2.1/device.xml")
+
+	list := search(t, h2, "test:ssdptest+search")
+	if len(list) != 1 {
+		t.Fatalf("unexpected number of services: want=1 got=%d", len(list))
+	}
+	srv := list[0]
+	if srv.Location != "http://192.0.2.1/device.xml" {
+		t.Errorf("unexpected location: %s", srv.Location)
+	}
+	if got := srv.From.(*net.UDPAddr).IP.String(); got != "192.0.2.1" {
+		t.Errorf("unexpected from: %s", got)
+	}
+	if srv.Interface == nil || srv.Interface.Name != "eth0" {
+		t.Errorf("unexpected interface: %+v", srv.Interface)
+	}
+}
+
+func TestSearch_Loss(t *testing.T) {
+	n := NewNetwork()
+	h1 := n.NewHost("192.0.2.1/24")
+	h2 := n.NewHost("192.0.2.2/24")
+	newTestAdvertiser(t, h1, "test:ssdptest+loss", "http://192.0.2.1/device.xml")
+	n.SetLoss(1)
+
+	if list := search(t, h2, "test:ssdptest+loss"); len(list) != 0 {
+		t.Errorf("unexpected services: %+v", list)
+	}
+}
+
+func TestSearch_Delay(t *testing.T) {
+	n := NewNetwork()
+	h1 := n.NewHost("192.0.2.1/24")
+	h2 := n.NewHost("192.0.2.2/24")
+	newTestAdvertiser(t, h1, "test:ssdptest+delay", "http://192.0.2.1/device.xml")
+	n.SetDelay(20*time.Millisecond, 10*time.Millisecond)
+
+	if list := search(t, h2, "test:ssdptest+delay"); len(list) != 1 {
+		t.Errorf("unexpected number of services: want=1 got=%d", len(list))
+	}
+}
+
+func TestSearch_Subnets(t *testing.T) {
+	n := NewNetwork()
+	h1 := n.NewHost("192.0.2.1/24")
+	h2 := n.NewHost("198.51.100.2/24")
+	h3 := n.NewHost("198.51.100.3/24", "192.0.2.3/24")
+	newTestAdvertiser(t, h1, "test:ssdptest+subnets", "http://192.0.2.1/device.xml")
+
+	if list := search(t, h2, "test:ssdptest+subnets"); len(list) != 0 {
+		t.Errorf("services are found in other subnet: %+v", list)
+	}
+	list := search(t, h3, "test:ssdptest+subnets")
+	if len(list) != 1 {
+		t.Fatalf("unexpected number of services: want=1 got=%d", len(list))
+	}
+	if list[0].Interface == nil || list[0].Interface.Name != "eth1" {
+		t.Errorf("unexpected interface: %+v", list[0].Interface)
+	}
+}
+
+type testLocalLocation struct{}
+
+func (testLocalLocation) Location(net.Addr, *net.Interface) string {
+	return "http://unknown/device.xml"
+}
+
+func (testLocalLocation) LocalLocation(from, local net.Addr, ifi *net.Interface) string {
+	if local == nil {
+		return "http://unknown/device.xml"
+	}
+	return "http://" + local.(*net.UDPAddr).IP.String() + "/device.xml"
+}
+
+func TestSearch_LocalLocation(t *testing.T) {
+	n := NewNetwork()
+	h1 := n.NewHost("192.0.2.1/24", "198.51.100.1/24")
+	h2 := n.NewHost("192.0.2.2/24")
+	h3 := n.NewHost("198.51.100.3/24")
+	newTestAdvertiser(t, h1, "test:ssdptest+local", testLocalLocation{})
+
+	for _, tc := range []struct {
+		h    *Host
+		want string
+	}{
+		{h2, "http://192.0.2.1/device.xml"},
+		{h3, "http://198.51.100.1/device.xml"},
+	} {
+		list := search(t, tc.h, "test:ssdptest+local")
+		if len(list) != 1 {
+			t.Fatalf("unexpected number of services: want=1 got=%d", len(list))
+		}
+		if got := list[0].Location; got != tc.want {
+			t.Errorf("unexpected location: want=%s got=%s", tc.want, got)
+		}
+	}
+}
+
+func TestAdvertise_URLLocation(t *testing.T) {
+	n := NewNetwork()
+	h1 := n.NewHost("192.0.2.1/24")
+	h2 := n.NewHost("192.0.2.2/24")
+
+	locations := make(chan string, 10)
+	m := &ssdp.Monitor{
+		Alive: func(m *ssdp.AliveMessage) {
+			if m.Type == "test:ssdptest+urllocation" {
+				locations <- m.Location
+			}
+		},
+		Options: []ssdp.Option{ssdp.UseTransport(h2)},
+	}
+	if err := m.Start(); err != nil {
+		t.Fatalf("failed to start Monitor: %s", err)
+	}
+	defer m.Close()
+
+	ad := newTestAdvertiser(t, h1, "test:ssdptest+urllocation", ssdp.HTTPLocation(8080, "/device.xml"))
+	if err := ad.Alive(); err != nil {
+		t.Fatalf("failed to send alive: %s", err)
+	}
+	select {
+	case got := <-locations:
+		if want := "http://192.0.2.1:8080/device.xml"; got != want {
+			t.Errorf("unexpected location: want=%s got=%s", want, got)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("alive is not received")
+	}
+	list := search(t, h2, "test:ssdptest+urllocation")
+	if len(list) != 1 || list[0].Location != "http://192.0.2.1:8080/device.xml" {
+		t.Errorf("unexpected services: %+v", list)
+	}
+}
+
+func TestMonitor(t *testing.T) {
+	n := NewNetwork()
+	h1 := n.NewHost("2001:db8::1/64")
+	h2 := n.NewHost("2001:db8::2/64")
+
+	var mu sync.Mutex
+	var alive, bye int
+	m := &ssdp.Monitor{
+		Alive: func(m *ssdp.AliveMessage) {
+			if m.Type == "test:ssdptest+monitor" {
+				mu.Lock()
+				alive++
+				mu.Unlock()
+			}
+		},
+		Bye: func(m *ssdp.ByeMessage) {
+			if m.Type == "test:ssdptest+monitor" {
+				mu.Lock()
+				bye++
+				mu.Unlock()
+			}
+		},
+		Options: []ssdp.Option{ssdp.UseTransport(h2)},
+	}
+	if err := m.Start(); err != nil {
+		t.Fatalf("failed to start Monitor: %s", err)
+	}
+	defer m.Close()
+
+	ad := newTestAdvertiser(t, h1, "test:ssdptest+monitor", "http://[2001:db8::1]/device.xml")
+	if err := ad.Alive(); err != nil {
+		t.Fatalf("failed to send alive: %s", err)
+	}
+	if err := ad.Bye(); err != nil {
+		t.Fatalf("failed to send bye: %s", err)
+	}
+	time.Sleep(100 * time.Millisecond)
+
+	mu.Lock()
+	defer mu.Unlock()
+	if alive == 0 || bye == 0 {
+		t.Errorf("messages are not received: alive=%d bye=%d", alive, bye)
+	}
+}
+
+func TestAdvertise_SearchPort(t *testing.T) {
+	n := NewNetwork()
+	h1 := n.NewHost("192.0.2.1/24")
+	h2 := n.NewHost("192.0.2.2/24")
+	ad, err := ssdp.Advertise("test:ssdptest+searchport", "uuid:test:ssdptest+searchport", "http://192.0.2.1/device.xml", "test", 600, ssdp.UseTransport(h1), ssdp.SearchPort(50000))
+	if err != nil {
+		t.Fatalf("failed to advertise: %s", err)
+	}
+	defer ad.Close()
+	if _, err := ssdp.Advertise("test:ssdptest+searchport", "uuid:other", "http://192.0.2.1/other.xml", "test", 600, ssdp.UseTransport(h1), ssdp.SearchPort(50000)); err == nil {
+		t.Error("Advertise should fail when SEARCHPORT is in use")
+	}
+
+	conn, err := h2.ListenUnicast("")
+	if err != nil {
+		t.Fatalf("failed to listen: %s", err)
+	}
+	defer conn.Close()
+	req := (&ssdp.MSearch{Host: "192.0.2.1:50000", ST: "test:ssdptest+searchport"}).Marshal()
+	if _, err := conn.WriteTo(func(*net.Interface) []byte { return req }, &net.UDPAddr{IP: net.IPv4(192, 0, 2, 1), Port: 50000}, nil); err != nil {
+		t.Fatalf("failed to send M-SEARCH: %s", err)
+	}
+	var got *ssdp.SearchResponse
+	conn.ReadPackets(time.Second, func(from net.Addr, data []byte, _ *net.Interface, _ net.Addr) error {
+		msg, err := ssdp.ParseMessage(data)
+		if err != nil {
+			t.Errorf("failed to parse a response: %s", err)
+			return err
+		}
+		got, _ = msg.(*ssdp.SearchResponse)
+		if port := from.(*net.UDPAddr).Port; port != 50000 {
+			t.Errorf("unexpected port of response: %d", port)
+		}
+		return io.EOF
+	})
+	if got == nil {
+		t.Fatal("response is not received")
+	}
+	if v := got.Fields.Get("SEARCHPORT.UPNP.ORG"); v != "50000" {
+		t.Errorf("unexpected SEARCHPORT.UPNP.ORG: %q", v)
+	}
+}
+
+func TestNewHost_Invalid(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("NewHost should panic with an invalid address")
+		}
+	}()
+	NewNetwork().NewHost("192.0.2.1")
+}
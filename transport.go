@@ -0,0 +1,192 @@
+package ssdp
+
+import (
+	"net"
+	"sync"
+	"time"
+
+	"github.com/koron/go-ssdp/internal/multicast"
+)
+
+// Transport opens connections to send and to receive SSDP messages.
+// UDP multicast is used as default, and UseTransport() option replaces it,
+// for example with a virtual network of ssdptest package for tests.
+type Transport interface {
+	// ListenMulticast listens multicast messages on SSDP port.  It is used
+	// by Advertiser and Monitor.
+	ListenMulticast() (TransportConn, error)
+
+	// ListenUnicast listens on laddr to send messages, and to receive
+	// responses for them.  laddr may be empty.  It is used by Search and
+	// announcements.
+	ListenUnicast(laddr string) (TransportConn, error)
+}
+
+// TransportConn is a connection which is opened by Transport.
+type TransportConn interface {
+	// Groups returns multicast group addresses to send messages.
+	Groups() []*net.UDPAddr
+
+	// WriteTo sends a message to an address.  When ifi is nil, multicast
+	// messages are sent via all interfaces, and unicast messages are sent
+	// via an interface which the system chooses.  Otherwise messages are
+	// sent via ifi.  data is called for each interface to build a message.
+	WriteTo(data func(ifi *net.Interface) []byte, to net.Addr, ifi *net.Interface) (int, error)
+
+	// ReadPackets reads packets and calls h for each of them, until
+	// timeout elapsed, h returns an error or the connection is closed.
+	// Zero timeout means no timeouts.  This returns nil when timeout
+	// elapsed, and io.EOF when the connection is closed.
+	// h is called with a sender of a packet, data, an interface which
+	// received it and its destination address.  The interface and the
+	// destination may be nil when unknown.  data is valid only until h
+	// returns.
+	ReadPackets(timeout time.Duration, h func(from net.Addr, data []byte, ifi *net.Interface, dst net.Addr) error) error
+
+	// LocalAddr returns a local address of the connection.
+	LocalAddr() net.Addr
+
+	// Close closes the connection.
+	Close() error
+}
+
+// InterfaceAddrsProvider is an optional interface of TransportConn, which
+// provides addresses of interfaces.  It is for interfaces which the system
+// doesn't know, like virtual ones.  net.Interface.Addrs() is used for
+// TransportConn which doesn't implement this.
+type InterfaceAddrsProvider interface {
+	InterfaceAddrs(ifi *net.Interface) ([]net.Addr, error)
+}
+
+// interfaceAddrsOf returns a function to get addresses of an interface for
+// the connection.
+func interfaceAddrsOf(conn TransportConn) func(*net.Interface) ([]net.Addr, error) {
+	if p, ok := conn.(InterfaceAddrsProvider); ok {
+		return p.InterfaceAddrs
+	}
+	return (*net.Interface).Addrs
+}
+
+// udpTransport is a Transport with UDP multicast.
+type udpTransport struct {
+	cfg multicastConfig
+}
+
+func (t udpTransport) ListenMulticast() (TransportConn, error) {
+	conn, err := multicast.Listen(t.cfg.recvAddrResolver(), t.cfg.options()...)
+	if err != nil {
+		return nil, err
+	}
+	return &udpConn{conn: conn}, nil
+}
+
+func (t udpTransport) ListenUnicast(laddr string) (TransportConn, error) {
+	conn, err := multicast.Listen(&multicast.AddrResolver{Addr: laddr}, t.cfg.options()...)
+	if err != nil {
+		return nil, err
+	}
+	return &udpConn{conn: conn}, nil
+}
+
+// udpConn is a TransportConn with UDP multicast.
+type udpConn struct {
+	conn *multicast.Conn
+	ifis interfaceCache
+}
+
+func (c *udpConn) Groups() []*net.UDPAddr {
+	return c.conn.Groups()
+}
+
+func (c *udpConn) WriteTo(data func(*net.Interface) []byte, to net.Addr, ifi *net.Interface) (int, error) {
+	return c.conn.WriteToIfi(multicast.DataProviderFunc(data), to, ifi)
+}
+
+func (c *udpConn) ReadPackets(timeout time.Duration, h func(net.Addr, []byte, *net.Interface, net.Addr) error) error {
+	return c.conn.ReadPackets(timeout, func(from net.Addr, data []byte, info multicast.PacketInfo) error {
+		var dst net.Addr
+		if info.Dst != nil {
+			dst = info.Dst
+		}
+		return h(from, data, c.ifis.get(info.IfIndex), dst)
+	})
+}
+
+func (c *udpConn) LocalAddr() net.Addr {
+	return c.conn.LocalAddr()
+}
+
+func (c *udpConn) Close() error {
+	return c.conn.Close()
+}
+
+func (c *udpConn) updateInterfaces() ([]multicast.Joined, error) {
+	c.ifis.reset()
+	return c.conn.UpdateInterfaces()
+}
+
+// interfaceCache caches interfaces by index, to avoid looking up them for
+// each received packet.  It is reset when interfaces are updated.
+type interfaceCache struct {
+	mu sync.RWMutex
+	m  map[int]*net.Interface
+}
+
+// get returns an interface for the index.  This returns nil when the index
+// is 0 or the interface is not found.
+func (c *interfaceCache) get(index int) *net.Interface {
+	if index <= 0 {
+		return nil
+	}
+	c.mu.RLock()
+	ifi, ok := c.m[index]
+	c.mu.RUnlock()
+	if ok {
+		return ifi
+	}
+	ifi = interfaceByIndex(index)
+	if ifi == nil {
+		return nil
+	}
+	c.mu.Lock()
+	if c.m == nil {
+		c.m = map[int]*net.Interface{}
+	}
+	c.m[index] = ifi
+	c.mu.Unlock()
+	return ifi
+}
+
+func (c *interfaceCache) reset() {
+	c.mu.Lock()
+	clear(c.m)
+	c.mu.Unlock()
+}
+
+// interfaceUpdater is implemented by TransportConn which can follow changes
+// of network interfaces.
+type interfaceUpdater interface {
+	updateInterfaces() ([]multicast.Joined, error)
+}
+
+// bytesData returns a function which provides b for all interfaces.
+func bytesData(b []byte) func(*net.Interface) []byte {
+	return func(*net.Interface) []byte {
+		return b
+	}
+}
+
+// groupFor returns a multicast group address of conn for the family of an
+// address.  This returns nil when no groups are found.
+func groupFor(conn TransportConn, addr net.Addr) *net.UDPAddr {
+	v4 := true
+	if uaddr, ok := addr.(*net.UDPAddr); ok {
+		v4 = uaddr.IP.To4() != nil
+	}
+	for _, g := range conn.Groups() {
+		if (g.IP.To4() != nil) == v4 {
+			return g
+		}
+	}
+	return nil
+}
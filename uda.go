@@ -0,0 +1,152 @@
+package ssdp
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Headers defined by UPnP Device Architecture 1.1.
+const (
+	hdrBootID     = "BOOTID.UPNP.ORG"
+	hdrConfigID   = "CONFIGID.UPNP.ORG"
+	hdrSearchPort = "SEARCHPORT.UPNP.ORG"
+	hdrNextBootID = "NEXTBOOTID.UPNP.ORG"
+)
+
+// Ranges of values for UPnP Device Architecture 1.1 headers.
+const (
+	maxBootID     = 1<<31 - 1
+	maxConfigID   = 1<<24 - 1
+	minSearchPort = 49152
+	maxSearchPort = 65535
+)
+
+// udaHeader holds values of headers defined by UPnP Device Architecture 1.1.
+// Negative values mean "not available".
+type udaHeader struct {
+	bootID     int
+	configID   int
+	searchPort int
+}
+
+var noUDAHeader = udaHeader{bootID: -1, configID: -1, searchPort: -1}
+
+// fields returns header fields for available values.
+func (h udaHeader) fields() Fields {
+	var fs Fields
+	if h.bootID >= 0 {
+		fs.Add(hdrBootID, strconv.Itoa(h.bootID))
+	}
+	if h.configID >= 0 {
+		fs.Add(hdrConfigID, strconv.Itoa(h.configID))
+	}
+	if h.searchPort >= 0 {
+		fs.Add(hdrSearchPort, strconv.Itoa(h.searchPort))
+	}
+	return fs
+}
+
+type udaConfig struct {
+	bootID      int
+	configID    int
+	searchPort  int
+	hasBootID   bool
+	hasConfigID bool
+	bootIDStore BootIDStore
+}
+
+// header determines values of UPnP Device Architecture 1.1 headers.
+// When a BootIDStore is given, BOOTID is loaded from the store, and it is
+// incremented and stored when increment is true.
+func (c udaConfig) header(increment bool) (udaHeader, error) {
+	h := noUDAHeader
+	if c.hasBootID {
+		h.bootID = c.bootID
+	}
+	if c.bootIDStore != nil {
+		id, err := c.bootIDStore.LoadBootID()
+		if err != nil {
+			return udaHeader{}, err
+		}
+		if increment {
+			id = nextBootID(id)
+			if err := c.bootIDStore.StoreBootID(id); err != nil {
+				return udaHeader{}, err
+			}
+		}
+		h.bootID = id
+	}
+	if c.hasConfigID {
+		h.configID = c.configID
+	}
+	if c.searchPort > 0 {
+		h.searchPort = c.searchPort
+	}
+	return h, nil
+}
+
+// nextBootID returns a BOOTID which is next of id.
+func nextBootID(id int) int {
+	if id < 0 || id >= maxBootID {
+		return 0
+	}
+	return id + 1
+}
+
+// BootIDStore persists a value of BOOTID.UPNP.ORG header across restarts.
+type BootIDStore interface {
+	// LoadBootID loads a stored BOOTID.  This returns 0 when no values are
+	// stored yet.
+	LoadBootID() (int, error)
+
+	// StoreBootID stores a BOOTID.
+	StoreBootID(int) error
+}
+
+// FileBootIDStore is a BootIDStore which stores BOOTID in a file of the
+// path.
+type FileBootIDStore string
+
+// LoadBootID loads a BOOTID from the file.
+func (s FileBootIDStore) LoadBootID() (int, error) {
+	b, err := os.ReadFile(string(s))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return 0, nil
+		}
+		return 0, err
+	}
+	id, err := strconv.Atoi(strings.TrimSpace(string(b)))
+	if err != nil {
+		return 0, fmt.Errorf("invalid BOOTID in %s: %w", string(s), err)
+	}
+	return id, nil
+}
+
+// StoreBootID stores a BOOTID to the file.
+func (s FileBootIDStore) StoreBootID(id int) error {
+	return os.WriteFile(string(s), []byte(strconv.Itoa(id)+"\n"), 0666)
+}
+
+// headerInt extracts an integer value of the header.  This returns -1 when
+// the header is not available or invalid.
+func headerInt(h http.Header, key string) int {
+	return parseHeaderInt(h.Get(key))
+}
+
+// parseHeaderInt parses an integer value of a header.  This returns -1 when
+// the value is empty or invalid.
+func parseHeaderInt(v string) int {
+	if v == "" {
+		return -1
+	}
+	n, err := strconv.ParseInt(strings.TrimSpace(v), 10, 32)
+	if err != nil || n < 0 {
+		return -1
+	}
+	return int(n)
+}
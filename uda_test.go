@@ -0,0 +1,69 @@
+package ssdp
+
+import (
+	"net/http"
+	"path/filepath"
+	"testing"
+)
+
+func TestFileBootIDStore(t *testing.T) {
+	store := FileBootIDStore(filepath.Join(t.TempDir(), "bootid"))
+	id, err := store.LoadBootID()
+	if err != nil {
+		t.Fatalf("failed to load BOOTID: %s", err)
+	}
+	if id != 0 {
+		t.Errorf("unexpected initial BOOTID: want=0 got=%d", id)
+	}
+	cfg := udaConfig{bootIDStore: store}
+	for i := 1; i <= 3; i++ {
+		h, err := cfg.header(true)
+		if err != nil {
+			t.Fatalf("failed to determine headers #%d: %s", i, err)
+		}
+		if h.bootID != i {
+			t.Errorf("unexpected BOOTID #%d: want=%d got=%d", i, i, h.bootID)
+		}
+	}
+	// not incremented
+	h, err := cfg.header(false)
+	if err != nil {
+		t.Fatalf("failed to determine headers: %s", err)
+	}
+	if h.bootID != 3 {
+		t.Errorf("unexpected BOOTID: want=3 got=%d", h.bootID)
+	}
+}
+
+func TestNextBootID(t *testing.T) {
+	for i, tc := range []struct{ in, want int }{
+		{0, 1},
+		{100, 101},
+		{maxBootID - 1, maxBootID},
+		{maxBootID, 0},
+		{-1, 0},
+	} {
+		if got := nextBootID(tc.in); got != tc.want {
+			t.Errorf("#%d nextBootID(%d) mismatch: want=%d got=%d", i, tc.in, tc.want, got)
+		}
+	}
+}
+
+func TestHeaderInt(t *testing.T) {
+	h := http.Header{}
+	h.Set(hdrBootID, "123")
+	h.Set(hdrConfigID, "foo")
+	h.Set(hdrSearchPort, "-1")
+	if v := headerInt(h, hdrBootID); v != 123 {
+		t.Errorf("unexpected BOOTID: want=123 got=%d", v)
+	}
+	if v := headerInt(h, hdrConfigID); v != -1 {
+		t.Errorf("unexpected CONFIGID: want=-1 got=%d", v)
+	}
+	if v := headerInt(h, hdrSearchPort); v != -1 {
+		t.Errorf("unexpected SEARCHPORT: want=-1 got=%d", v)
+	}
+	if v := headerInt(h, "NOT-EXIST"); v != -1 {
+		t.Errorf("unexpected value for absent header: want=-1 got=%d", v)
+	}
+}
@@ -0,0 +1,253 @@
+package ssdp
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// URLLocation is a LocationProvider for a HTTP server on this host.  It
+// formats a location with an address of the interface which is reachable
+// from a requester, like "http://192.168.0.10:8080/description.xml".
+//
+// An address in the same network with the requester is preferred, then
+// IPv4, global IPv6 and link-local IPv6 addresses.  IPv6 addresses are
+// bracketed, and link-local ones have zones of interfaces.  Advertiser
+// removes the zones before sending.
+//
+// Addresses of all interfaces are used when the interface has no
+// addresses, and the host name is used when no addresses are found, so
+// the location is never empty.
+type URLLocation struct {
+	// Scheme is a scheme of the location.  "http" is used when empty.
+	Scheme string
+
+	// IP is an address of the server.  It is used always when not nil nor
+	// unspecified, otherwise an address is chosen for each requester.
+	IP net.IP
+
+	// Port is a port of the server.
+	Port int
+
+	// Path is a template of path of the location.  "{interface}" in it is
+	// replaced with a name of the interface.
+	Path string
+
+	// InterfaceAddrs returns addresses of an interface.  When this is nil,
+	// Advertiser uses addresses which its transport provides, and others use
+	// (*net.Interface).Addrs.
+	InterfaceAddrs func(*net.Interface) ([]net.Addr, error)
+}
+
+var (
+	_ LocalLocationProvider     = (*URLLocation)(nil)
+	_ transportLocationProvider = (*URLLocation)(nil)
+)
+
+// HTTPLocation creates a URLLocation for a HTTP server which listens port
+// on all interfaces.
+func HTTPLocation(port int, path string) *URLLocation {
+	return &URLLocation{Scheme: "http", Port: port, Path: path}
+}
+
+// HTTPSLocation creates a URLLocation for a HTTPS server which listens port
+// on all interfaces.
+func HTTPSLocation(port int, path string) *URLLocation {
+	return &URLLocation{Scheme: "https", Port: port, Path: path}
+}
+
+// ListenerLocation creates a URLLocation for a HTTP server which serves on
+// l.  Set Scheme to "https" for a TLS listener.
+func ListenerLocation(l net.Listener, path string) (*URLLocation, error) {
+	addr, ok := l.Addr().(*net.TCPAddr)
+	if !ok {
+		return nil, fmt.Errorf("listener should have TCP address but got %T", l.Addr())
+	}
+	return &URLLocation{Scheme: "http", IP: addr.IP, Port: addr.Port, Path: path}, nil
+}
+
+// ServerLocation creates a URLLocation for s from its Addr.  The scheme is
+// "https" when s has TLSConfig.  Host of Addr should be an IP address or
+// empty.
+func ServerLocation(s *http.Server, path string) (*URLLocation, error) {
+	scheme := "http"
+	if s.TLSConfig != nil {
+		scheme = "https"
+	}
+	addr := s.Addr
+	if addr == "" {
+		addr = ":"
+	}
+	host, service, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, err
+	}
+	if service == "" {
+		service = scheme
+	}
+	port, err := net.LookupPort("tcp", service)
+	if err != nil {
+		return nil, err
+	}
+	var ip net.IP
+	if host != "" {
+		ip = net.ParseIP(host)
+		if ip == nil {
+			return nil, fmt.Errorf("host of server should be an IP address: %q", host)
+		}
+	}
+	return &URLLocation{Scheme: scheme, IP: ip, Port: port, Path: path}, nil
+}
+
+// Location returns a location with an address of ifi, which is reachable
+// from "from".  All interfaces are looked up when ifi is nil.
+func (l *URLLocation) Location(from net.Addr, ifi *net.Interface) string {
+	return l.transportLocation(nil, from, nil, ifi)
+}
+
+// LocalLocation returns a location with local, which received a message
+// from "from".  It works as Location when local is unknown.
+func (l *URLLocation) LocalLocation(from, local net.Addr, ifi *net.Interface) string {
+	return l.transportLocation(nil, from, local, ifi)
+}
+
+// transportLocation returns a location with addresses which addrsOf
+// returns, when InterfaceAddrs is nil.
+func (l *URLLocation) transportLocation(addrsOf func(*net.Interface) ([]net.Addr, error), from, local net.Addr, ifi *net.Interface) string {
+	if l.fixed() {
+		return l.format(l.IP.String(), ifi)
+	}
+	if a, ok := local.(*net.UDPAddr); ok && !a.IP.IsUnspecified() && !a.IP.IsMulticast() {
+		return l.format(withZone(a.IP, a.Zone), ifi)
+	}
+	if l.InterfaceAddrs != nil {
+		addrsOf = l.InterfaceAddrs
+	}
+	if addrsOf == nil {
+		addrsOf = (*net.Interface).Addrs
+	}
+	var fromIP net.IP
+	if a, ok := from.(*net.UDPAddr); ok {
+		fromIP = a.IP
+	}
+	ip, zone := chooseAddr(addrsOf, fromIP, ifi)
+	if ip == nil && ifi != nil {
+		ip, zone = chooseAddr(addrsOf, fromIP, nil)
+	}
+	if ip == nil {
+		return l.format(hostname(), ifi)
+	}
+	return l.format(withZone(ip, zone), ifi)
+}
+
+func (l *URLLocation) fixed() bool {
+	return l.IP != nil && !l.IP.IsUnspecified()
+}
+
+// chooseAddr chooses an address of ifi for from, and returns it with a zone
+// for IPv6 link-local address.  All interfaces are looked up when ifi is nil.
+// This returns nil when no addresses are found.
+func chooseAddr(addrsOf func(*net.Interface) ([]net.Addr, error), from net.IP, ifi *net.Interface) (net.IP, string) {
+	var ifis []net.Interface
+	if ifi != nil {
+		ifis = []net.Interface{*ifi}
+	} else {
+		var err error
+		ifis, err = net.Interfaces()
+		if err != nil {
+			return nil, ""
+		}
+	}
+	var (
+		best     net.IP
+		bestZone string
+		bestRank = -1
+	)
+	for i := range ifis {
+		addrs, err := addrsOf(&ifis[i])
+		if err != nil {
+			continue
+		}
+		for _, a := range addrs {
+			ipnet, ok := a.(*net.IPNet)
+			if !ok {
+				continue
+			}
+			if r := addrRank(ipnet, from); r > bestRank {
+				best, bestRank = ipnet.IP, r
+				bestZone = ""
+				if ipnet.IP.To4() == nil && ipnet.IP.IsLinkLocalUnicast() {
+					bestZone = ifis[i].Name
+				}
+			}
+		}
+	}
+	return best, bestZone
+}
+
+// addrRank ranks a local address for from, larger is better.
+func addrRank(ipnet *net.IPNet, from net.IP) int {
+	ip := ipnet.IP
+	if from != nil {
+		if ipnet.Contains(from) {
+			return 5
+		}
+		if (ip.To4() == nil) != (from.To4() == nil) {
+			return 0
+		}
+	}
+	switch {
+	case ip.IsLoopback():
+		return 1
+	case ip.To4() != nil:
+		return 4
+	case !ip.IsLinkLocalUnicast():
+		return 3
+	default:
+		return 2
+	}
+}
+
+// hostname returns the host name, or "localhost" when it is unknown.
+func hostname() string {
+	name, err := os.Hostname()
+	if err != nil || name == "" {
+		return "localhost"
+	}
+	return name
+}
+
+func withZone(ip net.IP, zone string) string {
+	if zone == "" || ip.To4() != nil {
+		return ip.String()
+	}
+	return ip.String() + "%" + zone
+}
+
+func (l *URLLocation) format(host string, ifi *net.Interface) string {
+	scheme := l.Scheme
+	if scheme == "" {
+		scheme = "http"
+	}
+	path := l.Path
+	if strings.Contains(path, "{interface}") {
+		var name string
+		if ifi != nil {
+			name = ifi.Name
+		}
+		path = strings.ReplaceAll(path, "{interface}", name)
+	}
+	if path != "" && !strings.HasPrefix(path, "/") {
+		path = "/" + path
+	}
+	u := url.URL{
+		Scheme: scheme,
+		Host:   net.JoinHostPort(host, strconv.Itoa(l.Port)),
+		Path:   path,
+	}
+	return u.String()
+}
@@ -0,0 +1,126 @@
+package ssdp
+
+import (
+	"crypto/tls"
+	"net"
+	"net/http"
+	"testing"
+)
+
+func TestURLLocation(t *testing.T) {
+	ifi := &net.Interface{Index: 1, Name: "eth0"}
+	l := HTTPLocation(8080, "/{interface}/desc.xml")
+	l.InterfaceAddrs = func(*net.Interface) ([]net.Addr, error) {
+		return []net.Addr{
+			&net.IPNet{IP: net.ParseIP("fe80::1"), Mask: net.CIDRMask(64, 128)},
+			&net.IPNet{IP: net.ParseIP("2001:db8::1"), Mask: net.CIDRMask(64, 128)},
+			&net.IPNet{IP: net.IPv4(192, 0, 2, 1).To4(), Mask: net.CIDRMask(24, 32)},
+			&net.IPNet{IP: net.IPv4(198, 51, 100, 1).To4(), Mask: net.CIDRMask(24, 32)},
+		}, nil
+	}
+	for i, tc := range []struct {
+		from net.Addr
+		want string
+	}{
+		// an address in the same network.
+		{&net.UDPAddr{IP: net.IPv4(198, 51, 100, 2)}, "http://198.51.100.1:8080/eth0/desc.xml"},
+		{&net.UDPAddr{IP: net.ParseIP("2001:db8::2")}, "http://[2001:db8::1]:8080/eth0/desc.xml"},
+		{&net.UDPAddr{IP: net.ParseIP("fe80::2"), Zone: "eth0"}, "http://[fe80::1%25eth0]:8080/eth0/desc.xml"},
+		// an address of the same family.
+		{&net.UDPAddr{IP: net.IPv4(203, 0, 113, 1)}, "http://192.0.2.1:8080/eth0/desc.xml"},
+		{&net.UDPAddr{IP: net.ParseIP("2001:db8:1::1")}, "http://[2001:db8::1]:8080/eth0/desc.xml"},
+		// IPv4 is preferred.
+		{nil, "http://192.0.2.1:8080/eth0/desc.xml"},
+	} {
+		if got := l.Location(tc.from, ifi); got != tc.want {
+			t.Errorf("#%d unexpected location for %v:\nwant=%q\n got=%q", i, tc.from, tc.want, got)
+		}
+	}
+}
+
+func TestURLLocation_LocalLocation(t *testing.T) {
+	l := HTTPSLocation(8443, "desc.xml")
+	for i, tc := range []struct {
+		local net.Addr
+		want  string
+	}{
+		{&net.UDPAddr{IP: net.IPv4(192, 0, 2, 1), Port: 1900}, "https://192.0.2.1:8443/desc.xml"},
+		{&net.UDPAddr{IP: net.ParseIP("fe80::1"), Zone: "eth0", Port: 1900}, "https://[fe80::1%25eth0]:8443/desc.xml"},
+	} {
+		if got := l.LocalLocation(nil, tc.local, nil); got != tc.want {
+			t.Errorf("#%d unexpected location:\nwant=%q\n got=%q", i, tc.want, got)
+		}
+	}
+	if got, want := searchLocation(l, nil, Source{LocalAddr: &net.UDPAddr{IP: net.ParseIP("fe80::1"), Zone: "eth0"}}), "https://[fe80::1]:8443/desc.xml"; got != want {
+		t.Errorf("unexpected location for response:\nwant=%q\n got=%q", want, got)
+	}
+}
+
+func TestListenerLocation(t *testing.T) {
+	ln, err := net.Listen("tcp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %s", err)
+	}
+	defer ln.Close()
+	l, err := ListenerLocation(ln, "/desc.xml")
+	if err != nil {
+		t.Fatalf("failed to create location: %s", err)
+	}
+	want := "http://" + ln.Addr().String() + "/desc.xml"
+	if got := l.Location(&net.UDPAddr{IP: net.IPv4(192, 0, 2, 1)}, nil); got != want {
+		t.Errorf("unexpected location:\nwant=%q\n got=%q", want, got)
+	}
+}
+
+func TestServerLocation(t *testing.T) {
+	for i, tc := range []struct {
+		s    *http.Server
+		want string
+	}{
+		{&http.Server{Addr: "192.0.2.1:8080"}, "http://192.0.2.1:8080/desc.xml"},
+		{&http.Server{Addr: "[2001:db8::1]:http"}, "http://[2001:db8::1]:80/desc.xml"},
+		{&http.Server{TLSConfig: &tls.Config{}, Addr: "192.0.2.1:"}, "https://192.0.2.1:443/desc.xml"},
+	} {
+		l, err := ServerLocation(tc.s, "/desc.xml")
+		if err != nil {
+			t.Errorf("#%d failed to create location: %s", i, err)
+			continue
+		}
+		if got := l.Location(nil, nil); got != tc.want {
+			t.Errorf("#%d unexpected location:\nwant=%q\n got=%q", i, tc.want, got)
+		}
+	}
+	if _, err := ServerLocation(&http.Server{Addr: "example.com:80"}, "/"); err == nil {
+		t.Error("ServerLocation should fail with a host name")
+	}
+}
+
+func TestURLLocation_TransportAddrs(t *testing.T) {
+	ifi := &net.Interface{Index: 1001, Name: "eth0"}
+	addrsOf := func(*net.Interface) ([]net.Addr, error) {
+		return []net.Addr{&net.IPNet{IP: net.IPv4(192, 0, 2, 1).To4(), Mask: net.CIDRMask(24, 32)}}, nil
+	}
+	l := HTTPLocation(8080, "/desc.xml")
+	if got, want := location(l, addrsOf, nil, ifi), "http://192.0.2.1:8080/desc.xml"; got != want {
+		t.Errorf("unexpected location with addresses of transport:\nwant=%q\n got=%q", want, got)
+	}
+	// InterfaceAddrs precedes addresses of transport.
+	l.InterfaceAddrs = func(*net.Interface) ([]net.Addr, error) {
+		return []net.Addr{&net.IPNet{IP: net.IPv4(198, 51, 100, 1).To4(), Mask: net.CIDRMask(24, 32)}}, nil
+	}
+	if got, want := location(l, addrsOf, nil, ifi), "http://198.51.100.1:8080/desc.xml"; got != want {
+		t.Errorf("unexpected location with InterfaceAddrs:\nwant=%q\n got=%q", want, got)
+	}
+}
+
+func TestURLLocation_Fallback(t *testing.T) {
+	ifi := &net.Interface{Index: 1001, Name: "eth0"}
+	l := HTTPLocation(8080, "/desc.xml")
+	l.InterfaceAddrs = func(*net.Interface) ([]net.Addr, error) {
+		return nil, nil
+	}
+	want := "http://" + net.JoinHostPort(hostname(), "8080") + "/desc.xml"
+	if got := l.Location(nil, ifi); got != want {
+		t.Errorf("location should fall back to the host name:\nwant=%q\n got=%q", want, got)
+	}
+}
@@ -0,0 +1,35 @@
+package ssdp
+
+import (
+	"time"
+
+	"github.com/koron/go-ssdp/internal/multicast"
+	"github.com/koron/go-ssdp/internal/ssdplog"
+)
+
+// watchInterfaces polls network interfaces with interval d, and updates
+// interfaces of conn until done is closed.  fn is called with interfaces
+// which joined newly, when it is not nil.
+// Connections which can't follow changes are not watched.
+func watchInterfaces(conn TransportConn, d time.Duration, done <-chan struct{}, log *ssdplog.Logger, fn func([]multicast.Joined)) {
+	u, ok := conn.(interfaceUpdater)
+	if !ok {
+		return
+	}
+	t := time.NewTicker(d)
+	defer t.Stop()
+	for {
+		select {
+		case <-t.C:
+		case <-done:
+			return
+		}
+		joined, err := u.updateInterfaces()
+		if err != nil {
+			log.Error("failed to update interfaces", ssdplog.KeyEvent, "interfaces", ssdplog.KeyError, err)
+		}
+		if len(joined) > 0 && fn != nil {
+			fn(joined)
+		}
+	}
+}
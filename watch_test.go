@@ -0,0 +1,99 @@
+package ssdp
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/koron/go-ssdp/internal/multicast"
+)
+
+func TestWatchInterfacesOption(t *testing.T) {
+	for i, tc := range []struct {
+		opts []Option
+		want time.Duration
+	}{
+		{nil, defaultWatchInterval},
+		{[]Option{WatchInterfaces(time.Second)}, time.Second},
+		{[]Option{WatchInterfaces(0)}, 0},
+		{[]Option{WatchInterfaces(-time.Second)}, 0},
+	} {
+		cfg, err := opts2config(tc.opts)
+		if err != nil {
+			t.Fatalf("#%d failed to apply options: %s", i, err)
+		}
+		if got := cfg.multicastConfig.interfaceWatchInterval(); got != tc.want {
+			t.Errorf("#%d unexpected interval: want=%s got=%s", i, tc.want, got)
+		}
+	}
+}
+
+func TestAdvertise_AliveJoined(t *testing.T) {
+	ifi, _ := findIPv4Interface(t)
+
+	var mu sync.Mutex
+	var mm []*AliveMessage
+	m := newTestMonitor(t, "test:advertise+alivejoined", func(m *AliveMessage) {
+		mu.Lock()
+		mm = append(mm, m)
+		mu.Unlock()
+	}, nil, nil)
+
+	a, err := Advertise("test:advertise+alivejoined", "usn:advertise+alivejoined", "location:advertise+alivejoined", "server:advertise+alivejoined", 600, WatchInterfaces(0))
+	if err != nil {
+		t.Fatalf("failed to Advertise: %s", err)
+	}
+	t.Cleanup(func() {
+		a.Close()
+	})
+	joined := []multicast.Joined{{Interface: ifi, Groups: a.conn.Groups()}}
+
+	// alive is not sent before announced.
+	a.aliveJoined(joined)
+	time.Sleep(monitorWait)
+	mu.Lock()
+	if len(mm) != 0 {
+		t.Errorf("alive is sent before announced: %d", len(mm))
+	}
+	mu.Unlock()
+
+	if err := a.Alive(); err != nil {
+		t.Fatalf("failed to send alive: %s", err)
+	}
+	time.Sleep(monitorWait)
+	mu.Lock()
+	mm = nil
+	mu.Unlock()
+
+	a.aliveJoined(joined)
+	time.Sleep(monitorWait)
+	m.Close()
+
+	mu.Lock()
+	t.Cleanup(mu.Unlock)
+	if len(mm) != 1 {
+		t.Fatalf("unexpected number of alives: want=%d got=%d", 1, len(mm))
+	}
+	if mm[0].Interface == nil || mm[0].Interface.Index != ifi.Index {
+		t.Errorf("alive is received on unexpected interface: %+v", mm[0].Interface)
+	}
+}
+
+func TestInterfaceCache(t *testing.T) {
+	ifi, _ := findIPv4Interface(t)
+	var c interfaceCache
+	if got := c.get(0); got != nil {
+		t.Errorf("index 0 should be nil: %+v", got)
+	}
+	first := c.get(ifi.Index)
+	if first == nil || first.Name != ifi.Name {
+		t.Fatalf("unexpected interface: want=%s got=%+v", ifi.Name, first)
+	}
+	if got := c.get(ifi.Index); got != first {
+		t.Errorf("interface should be cached: %p != %p", got, first)
+	}
+	c.reset()
+	if got := c.get(ifi.Index); got == first || got == nil || got.Name != ifi.Name {
+		t.Errorf("interface should be looked up again after reset: %+v", got)
+	}
+}